@@ -0,0 +1,336 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+)
+
+const (
+	ata_pass_through_16 = 0x85
+
+	// Protocols of ATA PASS-THROUGH command
+	sat_protocol_non_data = 3
+	sat_protocol_pio_in   = 4
+	sat_protocol_pio_out  = 5
+
+	// Extend bit of ATA PASS-THROUGH command, set for 48-bit commands
+	sat_extend = 0x01
+
+	// Flags of ATA PASS-THROUGH command: check condition, transfer from
+	// device, length in blocks and length given in sector count field
+	sat_ck_cond     = 0x20
+	sat_t_dir_in    = 0x08
+	sat_byte_block  = 0x04
+	sat_t_length_nr = 0x02
+
+	// ATA Status Return sense data descriptor
+	sat_ata_return_descriptor     = 0x09
+	sat_ata_return_descriptor_len = 14
+
+	sense_key_no_sense        = 0x00
+	sense_key_recovered       = 0x01
+	sense_key_illegal_request = 0x05
+
+	ata_status_err = 0x01
+
+	ata_read_log_ext  = 0x2f
+	gpl_log_directory = 0x00
+
+	// Values of LBA mid and high registers required by SMART commands
+	smart_lba_mid = 0x4f
+	smart_lba_hi  = 0xc2
+)
+
+// AtaCommand describes ATA command issued to device.
+// Data is transferred from device, unless DataOut is set, its length has
+// to be multiple of 512.
+// When Registers is set output registers are requested and written back
+// to the command. Extended marks 48-bit commands, which high order bytes
+// of registers are zero.
+type AtaCommand struct {
+	Command   byte
+	Features  byte
+	Count     byte
+	LbaLow    byte
+	LbaMid    byte
+	LbaHigh   byte
+	Data      []byte
+	DataOut   bool
+	Registers bool
+	Extended  bool
+
+	Status byte
+	Error  byte
+}
+
+// AtaTransport hides the way ATA commands are delivered to opened device.
+type AtaTransport interface {
+	AtaCommand(fd uintptr, cmd *AtaCommand) error
+}
+
+// smartCommand returns SMART command with given feature (subcommand).
+func smartCommand(feature byte) AtaCommand {
+	return AtaCommand{
+		Command:  win_smart,
+		Features: feature,
+		LbaMid:   smart_lba_mid,
+		LbaHigh:  smart_lba_hi,
+	}
+}
+
+// readSmartLog reads given number of sectors of log using SMART READ LOG.
+func readSmartLog(fd uintptr, transport AtaTransport, address byte, sectors int) ([]byte, error) {
+	cmd := smartCommand(smart_read_log)
+	cmd.LbaLow = address
+	cmd.Count = byte(sectors)
+	cmd.Data = make([]byte, sectors*512)
+
+	if err := transport.AtaCommand(fd, &cmd); err != nil {
+		return nil, err
+	}
+	return cmd.Data, nil
+}
+
+// writeSmartLog writes given sectors to log using SMART WRITE LOG.
+func writeSmartLog(fd uintptr, transport AtaTransport, address byte, data []byte) error {
+	cmd := smartCommand(smart_write_log)
+	cmd.LbaLow = address
+	cmd.Count = byte(len(data) / 512)
+	cmd.Data = data
+	cmd.DataOut = true
+
+	return transport.AtaCommand(fd, &cmd)
+}
+
+// readLogExt reads given number of pages of log starting at given page
+// using READ LOG EXT, which is available for General Purpose Logging
+// feature set only.
+func readLogExt(fd uintptr, transport AtaTransport, address byte, page byte, pages int) ([]byte, error) {
+	cmd := AtaCommand{
+		Command:  ata_read_log_ext,
+		Count:    byte(pages),
+		LbaLow:   address,
+		LbaMid:   page,
+		Data:     make([]byte, pages*512),
+		Extended: true,
+	}
+
+	if err := transport.AtaCommand(fd, &cmd); err != nil {
+		return nil, err
+	}
+	return cmd.Data, nil
+}
+
+// readGplLogPages returns number of pages of log with given address,
+// according to General Purpose Log Directory, 0 if log is not supported.
+func readGplLogPages(fd uintptr, transport AtaTransport, address byte) (int, error) {
+	directory, err := readLogExt(fd, transport, gpl_log_directory, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint16(directory[2*int(address):])), nil
+}
+
+// hdioTransport uses legacy HDIO_DRIVE_CMD and HDIO_DRIVE_TASK ioctls.
+type hdioTransport struct {
+	sysutilProvider SysutilProvider
+}
+
+// Supports tells whether command can be sent using HDIO ioctls, which
+// do not support 48-bit commands and data transfer to device.
+func (t *hdioTransport) Supports(cmd *AtaCommand) bool {
+	return !cmd.Extended && !cmd.DataOut
+}
+
+func (t *hdioTransport) AtaCommand(fd uintptr, cmd *AtaCommand) error {
+	if !t.Supports(cmd) {
+		return unsupportedError("Command not supported by HDIO ioctls")
+	}
+	if cmd.Registers {
+		if len(cmd.Data) > 0 {
+			return unsupportedError("HDIO_DRIVE_TASK does not transfer data")
+		}
+		buf := []byte{cmd.Command, cmd.Features, cmd.Count, cmd.LbaLow,
+			cmd.LbaMid, cmd.LbaHigh, 0}
+		if err := t.sysutilProvider.Ioctl(fd, hdio_drive_task, buf); err != nil {
+			return err
+		}
+		cmd.Status, cmd.Error = buf[0], buf[1]
+		cmd.Count, cmd.LbaLow, cmd.LbaMid, cmd.LbaHigh = buf[2], buf[3], buf[4], buf[5]
+		return nil
+	}
+
+	buf := make([]byte, 4+len(cmd.Data))
+	buf[0] = cmd.Command
+	buf[1] = cmd.LbaLow
+	buf[2] = cmd.Features
+	buf[3] = cmd.Count
+	if err := t.sysutilProvider.Ioctl(fd, hdio_drive_cmd, buf); err != nil {
+		return err
+	}
+	copy(cmd.Data, buf[4:])
+
+	return nil
+}
+
+// satTransport wraps ATA commands in ATA PASS-THROUGH(16) sent via SG_IO,
+// see SCSI / ATA Translation (SAT) standard.
+type satTransport struct {
+	sysutilProvider SysutilProvider
+}
+
+func (t *satTransport) AtaCommand(fd uintptr, cmd *AtaCommand) error {
+	cdb := make([]byte, 16)
+	cdb[0] = ata_pass_through_16
+	if len(cmd.Data) > 0 && cmd.DataOut {
+		cdb[1] = sat_protocol_pio_out << 1
+		cdb[2] = sat_byte_block | sat_t_length_nr
+	} else if len(cmd.Data) > 0 {
+		cdb[1] = sat_protocol_pio_in << 1
+		cdb[2] = sat_t_dir_in | sat_byte_block | sat_t_length_nr
+	} else {
+		cdb[1] = sat_protocol_non_data << 1
+	}
+	if cmd.Registers {
+		cdb[2] |= sat_ck_cond
+	}
+	if cmd.Extended {
+		cdb[1] |= sat_extend
+	}
+	cdb[4] = cmd.Features
+	cdb[6] = cmd.Count
+	cdb[8] = cmd.LbaLow
+	cdb[10] = cmd.LbaMid
+	cdb[12] = cmd.LbaHigh
+	cdb[14] = cmd.Command
+
+	sc := ScsiCommand{Cdb: cdb, Data: cmd.Data, DataOut: cmd.DataOut, Sense: make([]byte, 32)}
+	if err := t.sysutilProvider.SgIo(fd, &sc); err != nil {
+		return err
+	}
+
+	if sc.Status != scsi_status_good {
+		key := senseKey(sc.Sense)
+		if sc.Status != scsi_status_check_condition ||
+			(key != sense_key_recovered && key != sense_key_no_sense) {
+			return scsiStatusError("ATA PASS-THROUGH", sc.Status, sc.Sense)
+		}
+	}
+
+	desc := senseDescriptor(sc.Sense, sat_ata_return_descriptor)
+	if len(desc) < sat_ata_return_descriptor_len {
+		if cmd.Registers {
+			return unsupportedError("ATA PASS-THROUGH returned no registers")
+		}
+		return nil
+	}
+	cmd.Error, cmd.Status = desc[3], desc[13]
+	if cmd.Registers {
+		cmd.Count, cmd.LbaLow, cmd.LbaMid, cmd.LbaHigh = desc[5], desc[7], desc[9], desc[11]
+	}
+	if cmd.Status&ata_status_err != 0 {
+		return unsupportedError("ATA command aborted, error register = %#x", cmd.Error)
+	}
+
+	return nil
+}
+
+// fallbackTransport tries transports in order until one of them succeeds
+// and uses it for all subsequent commands. Selected transport is remembered
+// per device by providers implementing transportMemory.
+type fallbackTransport struct {
+	transports []AtaTransport
+	selected   AtaTransport
+	device     string
+	memory     transportMemory
+}
+
+// Implemented by transports which support only some commands.
+type limitedTransport interface {
+	Supports(cmd *AtaCommand) bool
+}
+
+// transportMemory is implemented by providers which remember index of
+// transport selected for device, so fallback happens once per device.
+type transportMemory interface {
+	SelectedTransport(device string) (int, bool)
+	SelectTransport(device string, index int)
+	ForgetTransport(device string)
+}
+
+func supports(transport AtaTransport, cmd *AtaCommand) bool {
+	if limited, ok := transport.(limitedTransport); ok {
+		return limited.Supports(cmd)
+	}
+	return true
+}
+
+// Commands not supported by selected transport are sent using the first
+// transport supporting them. Remembered transport which fails is forgotten,
+// so fallback is tried again by the next command.
+func (t *fallbackTransport) AtaCommand(fd uintptr, cmd *AtaCommand) error {
+	if t.selected != nil && supports(t.selected, cmd) {
+		err := t.selected.AtaCommand(fd, cmd)
+		if err != nil && t.memory != nil {
+			t.memory.ForgetTransport(t.device)
+		}
+		return err
+	}
+
+	err := unsupportedError("Command not supported by any transport")
+	for i, transport := range t.transports {
+		if !supports(transport, cmd) {
+			continue
+		}
+		if err = transport.AtaCommand(fd, cmd); err == nil {
+			if t.selected == nil {
+				t.selected = transport
+				if t.memory != nil {
+					t.memory.SelectTransport(t.device, i)
+				}
+			}
+			return nil
+		}
+	}
+
+	return err
+}
+
+// NewAtaTransport returns transport using HDIO_DRIVE_CMD when kernel
+// supports it for given device, otherwise ATA PASS-THROUGH via SG_IO.
+func NewAtaTransport(sysutilProvider SysutilProvider, device string) AtaTransport {
+	t := &fallbackTransport{
+		transports: []AtaTransport{
+			&hdioTransport{sysutilProvider},
+			&satTransport{sysutilProvider},
+		},
+		device: device,
+	}
+	if memory, ok := sysutilProvider.(transportMemory); ok {
+		t.memory = memory
+		if i, ok := memory.SelectedTransport(device); ok && i < len(t.transports) {
+			t.selected = t.transports[i]
+		}
+	}
+	return t
+}
@@ -0,0 +1,240 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeSatProvider struct {
+	fakeSysutilProvider
+
+	SgIoArgs   []ScsiCommand
+	SgIoRet    error
+	SgIoStatus byte
+	Sense      []byte
+	Data       []byte
+}
+
+func (s *fakeSatProvider) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	s.SgIoArgs = append(s.SgIoArgs, *cmd)
+	copy(cmd.Data, s.Data)
+	cmd.Sense = cmd.Sense[:copy(cmd.Sense, s.Sense)]
+	cmd.Status = s.SgIoStatus
+
+	return s.SgIoRet
+}
+
+// fakeMemoryProvider remembers selected transports as Linux provider does.
+type fakeMemoryProvider struct {
+	fakeSatProvider
+
+	memory *sysutilProviderLinux
+}
+
+func (s *fakeMemoryProvider) SelectedTransport(device string) (int, bool) {
+	return s.memory.SelectedTransport(device)
+}
+
+func (s *fakeMemoryProvider) SelectTransport(device string, index int) {
+	s.memory.SelectTransport(device, index)
+}
+
+func (s *fakeMemoryProvider) ForgetTransport(device string) {
+	s.memory.ForgetTransport(device)
+}
+
+// Descriptor format sense data with ATA Status Return descriptor.
+func ataReturnSense(status, lbaMid, lbaHigh byte) []byte {
+	return []byte{0x72, sense_key_recovered, 0x00, 0x1d, 0, 0, 0, 14,
+		sat_ata_return_descriptor, 12, 0, 0, 0, 0, 0, 0, 0, lbaMid, 0, lbaHigh, 0, status}
+}
+
+func TestSatTransport(t *testing.T) {
+	Convey("When legacy ioctl is not supported by kernel", t, func() {
+
+		provider := &fakeSatProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL"), errors.New("EINVAL")}},
+			Data: smartDataFixture(0x10, 0x05),
+		}
+		values, err := ReadSmartData("MYDEV", provider)
+
+		Convey("Should fall back to ATA PASS-THROUGH", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(len(provider.SgIoArgs), ShouldEqual, 2)
+
+		})
+
+		Convey("Should enable SMART using non-data protocol", func() {
+
+			cdb := provider.SgIoArgs[0].Cdb
+			So(cdb[0], ShouldEqual, ata_pass_through_16)
+			So(cdb[1], ShouldEqual, sat_protocol_non_data<<1)
+			So(cdb[4], ShouldEqual, smart_enable)
+			So(cdb[10], ShouldEqual, smart_lba_mid)
+			So(cdb[12], ShouldEqual, smart_lba_hi)
+			So(cdb[14], ShouldEqual, win_smart)
+
+		})
+
+		Convey("Should read data using PIO data-in protocol", func() {
+
+			cdb := provider.SgIoArgs[1].Cdb
+			So(cdb[1], ShouldEqual, sat_protocol_pio_in<<1)
+			So(cdb[2], ShouldEqual, 0x0e)
+			So(cdb[4], ShouldEqual, smart_read_values)
+			So(cdb[6], ShouldEqual, 1)
+			So(len(provider.SgIoArgs[1].Data), ShouldEqual, 512)
+
+		})
+
+		Convey("Should decode data read via SG_IO", func() {
+
+			So(values.Revision, ShouldEqual, 0x10)
+			So(values.Values[0].Id, ShouldEqual, 5)
+
+		})
+
+	})
+
+	Convey("When provider remembers selected transport", t, func() {
+
+		provider := &fakeMemoryProvider{
+			fakeSatProvider: fakeSatProvider{
+				fakeSysutilProvider: fakeSysutilProvider{
+					IoctlRets: []error{errors.New("EINVAL")}},
+				Data: smartDataFixture(0x10, 0x05),
+			},
+			memory: NewSysutilProvider("/proc", "/dev", "/sys").(*sysutilProviderLinux),
+		}
+		_, err := ReadSmartData("MYDEV", provider)
+		So(err, ShouldBeNil)
+		_, err = ReadSmartData("MYDEV", provider)
+
+		Convey("Legacy ioctl should be tried once per device", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(len(provider.SgIoArgs), ShouldEqual, 4)
+
+		})
+
+		Convey("Transport should be forgotten when it fails", func() {
+
+			provider.SgIoRet = errors.New("EIO")
+			_, err = ReadSmartData("MYDEV", provider)
+			So(err, ShouldNotBeNil)
+			_, ok := provider.SelectedTransport("MYDEV")
+			So(ok, ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("When both transports fail", t, func() {
+
+		provider := &fakeSatProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL")}},
+			SgIoRet: errors.New("EINVAL"),
+		}
+		_, err := ReadSmartData("MYDEV", provider)
+
+		Convey("Error should be about enabling smart", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "enable")
+
+		})
+
+	})
+
+	Convey("Reading status via ATA PASS-THROUGH", t, func() {
+
+		provider := &fakeSatProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL")}},
+			SgIoStatus: scsi_status_check_condition,
+			Sense:      ataReturnSense(0x50, smart_status_failed_lo, smart_status_failed_hi),
+		}
+		passed, err := ReadSmartStatus("MYDEV", provider)
+
+		Convey("Should request check condition", func() {
+
+			So(provider.SgIoArgs[0].Cdb[2]&sat_ck_cond, ShouldNotEqual, 0)
+
+		})
+
+		Convey("Should decode returned registers", func() {
+
+			So(err, ShouldBeNil)
+			So(passed, ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("When device aborts command", t, func() {
+
+		provider := &fakeSatProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL")}},
+			SgIoStatus: scsi_status_check_condition,
+			Sense:      ataReturnSense(0x51, 0, 0),
+		}
+		err := NewAtaTransport(provider, "MYDEV").AtaCommand(0, &AtaCommand{Command: win_smart})
+
+		Convey("Should report error", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "aborted")
+
+		})
+
+	})
+
+	Convey("When device does not support ATA PASS-THROUGH", t, func() {
+
+		provider := &fakeSatProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL")}},
+			SgIoStatus: scsi_status_check_condition,
+			Sense:      []byte{0x70, 0, 0x05, 0, 0, 0, 0, 10, 0, 0, 0, 0, 0x20, 0},
+		}
+		err := NewAtaTransport(provider, "MYDEV").AtaCommand(0, &AtaCommand{Command: win_smart})
+
+		Convey("Should report error with sense key", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "sense key = 0x5")
+
+		})
+
+	})
+}
@@ -0,0 +1,173 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Names of raw data formats used in attribute definition database.
+var formatNames = map[string]AttributeFormat{
+	"default":     FormatDefault,
+	"temperature": FormatTemperature,
+	"plpf":        FormatPLPF,
+	"fp1024":      FormatFP1024,
+	"tts":         FormatTTS,
+	// smartmontools formats, see smartctl -v option
+	"raw48":        FormatRaw48,
+	"raw16(avg16)": FormatRaw16Avg16,
+	"raw24/raw24":  FormatRaw24Raw24,
+	"hex48":        FormatHex48,
+	"min2hour":     FormatMin2Hour,
+	"sec2hour":     FormatSec2Hour,
+	"halfmin2hour": FormatHalfMin2Hour,
+	"msec24hour32": FormatMsec24Hour32,
+	"tempminmax":   FormatTempMinMax,
+	"temp10x":      FormatTemp10x,
+	"raw16(raw16)": FormatRaw16Raw16,
+}
+
+// ParseAttributeFormat returns format of raw data with given name.
+func ParseAttributeFormat(name string) (AttributeFormat, error) {
+	format, ok := formatNames[name]
+	if !ok {
+		return FormatDefault, errors.New(fmt.Sprintf("Unknown attribute format %s", name))
+	}
+	return format, nil
+}
+
+// DriveDefinition holds attribute definitions for drives which model and
+// firmware revision match given regular expressions.
+type DriveDefinition struct {
+	Model      *regexp.Regexp
+	Firmware   *regexp.Regexp
+	Attributes AttributeDefinitions
+}
+
+// AttributeDb holds attribute definitions for various drives.
+// Drives not matched by any definition use built-in AttributeMap.
+type AttributeDb struct {
+	Drives []DriveDefinition
+}
+
+// Layout of attribute definition database file, e.g.:
+//
+//	drives:
+//	  - model: "^INTEL SSDSC2BA"
+//	    firmware: "^G201"
+//	    attributes:
+//	      9: {name: poweronhours, format: default}
+//	      194: {name: temperature, format: temperature}
+//
+// Firmware is optional, format defaults to "default".
+type attributeDbFile struct {
+	Drives []struct {
+		Model      string `yaml:"model"`
+		Firmware   string `yaml:"firmware"`
+		Attributes map[int]struct {
+			Name   string `yaml:"name"`
+			Format string `yaml:"format"`
+		} `yaml:"attributes"`
+	} `yaml:"drives"`
+}
+
+// ParseAttributeDb decodes attribute definition database.
+func ParseAttributeDb(data []byte) (*AttributeDb, error) {
+	file := attributeDbFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	db := &AttributeDb{}
+	for i, d := range file.Drives {
+		model, err := regexp.Compile(d.Model)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Drive %d: invalid model: %v", i, err))
+		}
+		firmware, err := regexp.Compile(d.Firmware)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Drive %d: invalid firmware: %v", i, err))
+		}
+		attributes := AttributeDefinitions{}
+		for id, a := range d.Attributes {
+			if id < 1 || id > 255 {
+				return nil, errors.New(fmt.Sprintf("Drive %d: invalid attribute ID %d", i, id))
+			}
+			if a.Name == "" {
+				return nil, errors.New(fmt.Sprintf("Drive %d: attribute %d has no name", i, id))
+			}
+			format := FormatDefault
+			if a.Format != "" {
+				if format, err = ParseAttributeFormat(a.Format); err != nil {
+					return nil, errors.New(fmt.Sprintf("Drive %d: attribute %d: %v", i, id, err))
+				}
+			}
+			attributes[byte(id)] = Attribute{a.Name, format}
+		}
+		db.Drives = append(db.Drives, DriveDefinition{model, firmware, attributes})
+	}
+
+	return db, nil
+}
+
+// LoadAttributeDb reads attribute definition database from file.
+func LoadAttributeDb(path string) (*AttributeDb, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ParseAttributeDb(data)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %v", path, err))
+	}
+	return db, nil
+}
+
+// Lookup returns attribute definitions of first drive definition matching
+// given model and firmware revision, otherwise built-in ones.
+func (db *AttributeDb) Lookup(model, firmware string) AttributeDefinitions {
+	if db == nil {
+		return AttributeMap
+	}
+	for _, d := range db.Drives {
+		if d.Model.MatchString(model) && d.Firmware.MatchString(firmware) {
+			return d.Attributes
+		}
+	}
+	return AttributeMap
+}
+
+// ListKeys returns list of keys that can be used to access values of
+// attributes defined in database.
+func (db *AttributeDb) ListKeys() []string {
+	keys := []string{}
+	if db == nil {
+		return keys
+	}
+	for _, d := range db.Drives {
+		keys = append(keys, d.Attributes.ListKeys()...)
+	}
+	return keys
+}
@@ -0,0 +1,147 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const attributeDbFixture = `
+drives:
+  - model: "^Samsung SSD 850"
+    firmware: "^EMT0"
+    attributes:
+      9: {name: poweronhours}
+      177: {name: wearleveling, format: default}
+      190: {name: airflowtemperature, format: temperature}
+  - model: "^ST4000"
+    attributes:
+      1: {name: readerrorrate}
+      240: {name: headflyinghours, format: msec24hour32}
+      241: {name: totallbaswritten, format: "raw24/raw24"}
+`
+
+func TestAttributeDb(t *testing.T) {
+	Convey("Parsing attribute definition database", t, func() {
+
+		db, err := ParseAttributeDb([]byte(attributeDbFixture))
+
+		So(err, ShouldBeNil)
+		So(len(db.Drives), ShouldEqual, 2)
+
+		Convey("Matching drive uses its definitions", func() {
+
+			defs := db.Lookup("Samsung SSD 850 PRO 512GB", "EMT02B6Q")
+			So(defs, ShouldResemble, AttributeDefinitions{
+				9:   {"poweronhours", FormatDefault},
+				177: {"wearleveling", FormatDefault},
+				190: {"airflowtemperature", FormatTemperature},
+			})
+
+		})
+
+		Convey("Firmware is optional", func() {
+
+			defs := db.Lookup("ST4000NM0033-9ZM170", "SN04")
+			So(defs, ShouldResemble, AttributeDefinitions{
+				1:   {"readerrorrate", FormatDefault},
+				240: {"headflyinghours", FormatMsec24Hour32},
+				241: {"totallbaswritten", FormatRaw24Raw24},
+			})
+
+		})
+
+		Convey("Drive with other firmware uses built-in definitions", func() {
+
+			defs := db.Lookup("Samsung SSD 850 PRO 512GB", "EXM01B6Q")
+			So(defs, ShouldResemble, AttributeMap)
+
+		})
+
+		Convey("Keys of all definitions are listed", func() {
+
+			keys := db.ListKeys()
+			So(keys, ShouldContain, "wearleveling")
+			So(keys, ShouldContain, "airflowtemperature/max")
+			So(keys, ShouldContain, "readerrorrate/threshold")
+			So(keys, ShouldContain, "headflyinghours/milliseconds")
+			So(keys, ShouldContain, "totallbaswritten/divisor")
+
+		})
+
+	})
+
+	Convey("When database is not loaded", t, func() {
+
+		var db *AttributeDb
+
+		So(db.Lookup("any", "any"), ShouldResemble, AttributeMap)
+		So(db.ListKeys(), ShouldBeEmpty)
+
+	})
+
+	Convey("Parsing invalid database", t, func() {
+
+		for _, data := range []string{
+			"drives: [{model: \"(\"}]",
+			"drives: [{model: \".\", firmware: \"[\"}]",
+			"drives: [{model: \".\", attributes: {300: {name: x}}}]",
+			"drives: [{model: \".\", attributes: {1: {format: default}}}]",
+			"drives: [{model: \".\", attributes: {1: {name: x, format: unknown}}}]",
+			"drives: {",
+		} {
+			_, err := ParseAttributeDb([]byte(data))
+			So(err, ShouldNotBeNil)
+		}
+
+	})
+
+	Convey("Loading database from file", t, func() {
+
+		f, err := ioutil.TempFile("", "drivedb")
+		So(err, ShouldBeNil)
+		f.WriteString(attributeDbFixture)
+		f.Close()
+
+		db, err := LoadAttributeDb(f.Name())
+
+		So(err, ShouldBeNil)
+		So(len(db.Drives), ShouldEqual, 2)
+
+		Convey("Missing file is reported", func() {
+
+			_, err := LoadAttributeDb(f.Name() + ".missing")
+			So(err, ShouldNotBeNil)
+
+		})
+
+		Reset(func() {
+			os.Remove(f.Name())
+		})
+
+	})
+}
@@ -0,0 +1,125 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+// Bits of off-line data collection capability
+const (
+	offline_cap_execute_immediate = 0x01
+	offline_cap_auto_offline      = 0x02
+	offline_cap_abort_on_command  = 0x04
+	offline_cap_surface_scan      = 0x08
+	offline_cap_selftest          = 0x10
+	offline_cap_conveyance        = 0x20
+	offline_cap_selective         = 0x40
+
+	// Bits of SMART capability
+	smart_cap_saves_on_power_saving = 0x01
+	smart_cap_autosave              = 0x02
+
+	// Bit of error logging capability
+	error_logging_supported = 0x01
+
+	offline_status_auto_enabled = 0x80
+	// Extended self-test polling time is given in word if byte is FFh
+	polling_time_in_word = 0xff
+)
+
+// Keys of values describing off-line data collection and capabilities, see
+// SmartValues.GetCapabilities.
+var offlineKeys = []string{
+	"offline/status",
+	"offline/auto_enabled",
+	"offline/duration",
+}
+
+var capabilityBits = []struct {
+	key  string
+	mask byte
+}{
+	{"capability/offline_immediate", offline_cap_execute_immediate},
+	{"capability/auto_offline", offline_cap_auto_offline},
+	{"capability/offline_abort_on_command", offline_cap_abort_on_command},
+	{"capability/offline_surface_scan", offline_cap_surface_scan},
+	{"capability/selftest", offline_cap_selftest},
+	{"capability/conveyance_selftest", offline_cap_conveyance},
+	{"capability/selective_selftest", offline_cap_selective},
+}
+
+var capabilityKeys = []string{
+	"capability/attribute_autosave",
+	"capability/saves_on_power_saving",
+	"capability/error_logging",
+}
+
+var pollingTimeKeys = []string{
+	"selftest/polling/short",
+	"selftest/polling/extended",
+	"selftest/polling/conveyance",
+}
+
+func listCapabilityKeys() []string {
+	keys := append([]string{}, offlineKeys...)
+	for _, bit := range capabilityBits {
+		keys = append(keys, bit.key)
+	}
+	keys = append(keys, capabilityKeys...)
+	keys = append(keys, "selftest/status")
+	return append(keys, pollingTimeKeys...)
+}
+
+// ExtendedPollingMinutes returns recommended polling time for extended
+// self-test in minutes, which does not fit in single byte for large drives.
+func (sv SmartValues) ExtendedPollingMinutes() uint64 {
+	if sv.ExtendedPollingTime == polling_time_in_word {
+		return uint64(sv.ExtendedPollingTimeWord)
+	}
+	return uint64(sv.ExtendedPollingTime)
+}
+
+// GetCapabilities returns values describing off-line data collection,
+// current self-test execution status, supported SMART features and
+// recommended polling times of self-tests in minutes. Polling times are
+// present only for self-tests supported by device.
+func (sv SmartValues) GetCapabilities() map[string]interface{} {
+	status, _ := decodeSelfTestStatus(sv.SelfTestStatus)
+	ret_val := map[string]interface{}{
+		"offline/status":       uint64(sv.OfflineStatus &^ offline_status_auto_enabled),
+		"offline/auto_enabled": sv.OfflineStatus&offline_status_auto_enabled != 0,
+		"offline/duration":     uint64(uint16(sv.OfflineTimeout)),
+		"selftest/status":      uint64(status),
+
+		"capability/attribute_autosave":    sv.SmartCapability&smart_cap_autosave != 0,
+		"capability/saves_on_power_saving": sv.SmartCapability&smart_cap_saves_on_power_saving != 0,
+		"capability/error_logging":         sv.ErrorLogging&error_logging_supported != 0,
+	}
+	for _, bit := range capabilityBits {
+		ret_val[bit.key] = sv.OfflineCapability&bit.mask != 0
+	}
+	if sv.OfflineCapability&offline_cap_selftest != 0 {
+		ret_val["selftest/polling/short"] = uint64(sv.ShortPollingTime)
+		ret_val["selftest/polling/extended"] = sv.ExtendedPollingMinutes()
+	}
+	if sv.OfflineCapability&offline_cap_conveyance != 0 {
+		ret_val["selftest/polling/conveyance"] = uint64(sv.ConveyancePollingTime)
+	}
+	return ret_val
+}
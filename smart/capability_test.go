@@ -0,0 +1,98 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// capabilityFixture returns SMART data with given bytes at offsets 362-376,
+// describing off-line data collection and capabilities.
+func capabilityFixture(data ...byte) *SmartValues {
+	fields := make([]byte, 360+len(data))
+	copy(fields[360:], data)
+	values, err := ParseSmartValues(smartDataFixture(0x10, fields...))
+	So(err, ShouldBeNil)
+	return values
+}
+
+func TestGetCapabilities(t *testing.T) {
+	Convey("Decoding capabilities of modern drive", t, func() {
+
+		values := capabilityFixture(
+			0x82,       // auto off-line enabled, completed without error
+			0xf5,       // self-test in progress, 50% remaining
+			0x3c, 0x02, // 572 s of off-line data collection
+			0,
+			0x7d,       // all but auto off-line
+			0x03, 0x00, // attribute autosave
+			0x01, // error logging
+			0,
+			2,          // short self-test
+			0xff,       // extended self-test in word
+			5,          // conveyance self-test
+			0x1c, 0x02, // 540 min of extended self-test
+		)
+		attrs := values.GetCapabilities()
+
+		So(attrs["offline/status"], ShouldEqual, 2)
+		So(attrs["offline/auto_enabled"], ShouldBeTrue)
+		So(attrs["offline/duration"], ShouldEqual, 572)
+		So(attrs["selftest/status"], ShouldEqual, selftest_status_in_progress)
+
+		So(attrs["capability/offline_immediate"], ShouldBeTrue)
+		So(attrs["capability/auto_offline"], ShouldBeFalse)
+		So(attrs["capability/offline_surface_scan"], ShouldBeTrue)
+		So(attrs["capability/selftest"], ShouldBeTrue)
+		So(attrs["capability/conveyance_selftest"], ShouldBeTrue)
+		So(attrs["capability/selective_selftest"], ShouldBeTrue)
+		So(attrs["capability/attribute_autosave"], ShouldBeTrue)
+		So(attrs["capability/saves_on_power_saving"], ShouldBeTrue)
+		So(attrs["capability/error_logging"], ShouldBeTrue)
+
+		So(attrs["selftest/polling/short"], ShouldEqual, 2)
+		So(attrs["selftest/polling/extended"], ShouldEqual, 540)
+		So(attrs["selftest/polling/conveyance"], ShouldEqual, 5)
+
+		for k := range attrs {
+			So(listCapabilityKeys(), ShouldContain, k)
+		}
+
+	})
+
+	Convey("Decoding capabilities of drive without self-tests", t, func() {
+
+		values := capabilityFixture(0x00, 0x00, 0x00, 0x00, 0, 0x01, 0x00, 0x00, 0, 0, 0, 10)
+		attrs := values.GetCapabilities()
+
+		So(attrs["offline/status"], ShouldEqual, 0)
+		So(attrs["capability/selftest"], ShouldBeFalse)
+		So(attrs["capability/error_logging"], ShouldBeFalse)
+		So(attrs, ShouldNotContainKey, "selftest/polling/short")
+		So(attrs, ShouldNotContainKey, "selftest/polling/extended")
+		So(attrs, ShouldNotContainKey, "selftest/polling/conveyance")
+
+	})
+}
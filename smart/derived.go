@@ -0,0 +1,154 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"math"
+	"regexp"
+)
+
+// Sizes of units in which drives report amounts of data
+const (
+	sector_bytes         = 512
+	nvme_data_unit_bytes = 512000
+	intel_unit_bytes     = 32 << 20
+	seconds_per_hour     = 3600
+)
+
+// derivedRule computes derived metric from value with given key, which is
+// masked by Mask (if given) and multiplied by Scale. Rules with Model
+// apply only to drives which model matches it.
+type derivedRule struct {
+	Source string
+	Model  *regexp.Regexp
+	Mask   uint64
+	Scale  float64
+}
+
+// derivedMetric is value in common unit, computed by the first of its rules
+// which source value is available.
+type derivedMetric struct {
+	Key   string
+	Unit  string
+	Rules []derivedRule
+}
+
+// Intel SSDs report host writes and reads in 32MiB units
+var intelSsdModel = regexp.MustCompile(`^INTEL SSD`)
+
+var derivedMetrics = []derivedMetric{
+	{"derived/bytes_written", "B", []derivedRule{
+		{Source: "nvme/dataunits/written", Scale: nvme_data_unit_bytes},
+		{Source: "devstats/general/sectorswritten", Scale: sector_bytes},
+		{Source: "totallba/written", Model: intelSsdModel, Scale: intel_unit_bytes},
+		{Source: "hostwrites", Model: intelSsdModel, Scale: intel_unit_bytes},
+		{Source: "totallba/written", Scale: sector_bytes},
+	}},
+	{"derived/bytes_read", "B", []derivedRule{
+		{Source: "nvme/dataunits/read", Scale: nvme_data_unit_bytes},
+		{Source: "devstats/general/sectorsread", Scale: sector_bytes},
+		{Source: "totallba/read", Model: intelSsdModel, Scale: intel_unit_bytes},
+		{Source: "totallba/read", Scale: sector_bytes},
+	}},
+	{"derived/power_on_seconds", "s", []derivedRule{
+		{Source: "nvme/poweronhours", Scale: seconds_per_hour},
+		{Source: "devstats/general/poweronhours", Scale: seconds_per_hour},
+		{Source: "poweronhours", Scale: seconds_per_hour},
+	}},
+	{"derived/temperature_celsius", "C", []derivedRule{
+		{Source: "nvme/temperature", Scale: 1},
+		{Source: "sct/temperature/current", Scale: 1},
+		{Source: "devstats/temperature/current", Scale: 1},
+		{Source: "scsi/temperature", Scale: 1},
+		{Source: "casetemperature", Scale: 1},
+		// Higher bytes of raw value often hold minimal and maximal temperature
+		{Source: "internaltemperature", Mask: 0xff, Scale: 1},
+	}},
+}
+
+// Units of derived metrics, by key
+var derivedUnits = map[string]string{}
+
+// Keys of derived metrics
+var derivedKeys = []string{}
+
+func init() {
+	for _, m := range derivedMetrics {
+		derivedUnits[m.Key] = m.Unit
+		derivedKeys = append(derivedKeys, m.Key)
+	}
+}
+
+// scaleValue multiplies value of metric by scale, applying mask to unsigned
+// integers. Integers scaled by integral factor stay uint64 or int64, so
+// large counters keep their precision; unsigned ones saturate at
+// math.MaxUint64. Other values are scaled as float64. Values of types which
+// are not numeric are not scaled.
+func scaleValue(v interface{}, mask uint64, scale float64) (interface{}, bool) {
+	var i uint64
+	switch v := v.(type) {
+	case float64:
+		return v * scale, true
+	case int64:
+		if scale != math.Trunc(scale) {
+			return float64(v) * scale, true
+		}
+		return v * int64(scale), true
+	case uint64:
+		i = v
+	case uint16:
+		i = uint64(v)
+	case uint8:
+		i = uint64(v)
+	default:
+		return nil, false
+	}
+	if mask != 0 {
+		i &= mask
+	}
+	if scale != math.Trunc(scale) || scale < 0 {
+		return float64(i) * scale, true
+	}
+	if scale != 0 && i > math.MaxUint64/uint64(scale) {
+		return uint64(math.MaxUint64), true
+	}
+	return i * uint64(scale), true
+}
+
+// DeriveMetrics computes metrics in common units (bytes, seconds, degrees
+// Celsius) from given values of drive with given model. Metrics are
+// omitted when none of their sources is available.
+func DeriveMetrics(values map[string]interface{}, model string) map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	for _, m := range derivedMetrics {
+		for _, rule := range m.Rules {
+			if rule.Model != nil && !rule.Model.MatchString(model) {
+				continue
+			}
+			v, ok := scaleValue(values[rule.Source], rule.Mask, rule.Scale)
+			if !ok {
+				continue
+			}
+			ret_val[m.Key] = v
+			break
+		}
+	}
+	return ret_val
+}
@@ -0,0 +1,106 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeriveMetrics(t *testing.T) {
+	Convey("Deriving metrics of ATA drive", t, func() {
+
+		values := map[string]interface{}{
+			"totallba/written":    uint64(1000),
+			"totallba/read":       uint64(3000),
+			"poweronhours":        uint64(10),
+			"internaltemperature": uint64(0x002d0014001f),
+		}
+
+		Convey("Sectors and hours are converted", func() {
+			So(DeriveMetrics(values, "ST4000NM0033"), ShouldResemble, map[string]interface{}{
+				"derived/bytes_written":       uint64(512000),
+				"derived/bytes_read":          uint64(1536000),
+				"derived/power_on_seconds":    uint64(36000),
+				"derived/temperature_celsius": uint64(31),
+			})
+		})
+
+		Convey("Intel SSDs report data in 32MiB units", func() {
+			derived := DeriveMetrics(values, "INTEL SSDSC2BA400G3")
+			So(derived["derived/bytes_written"], ShouldEqual, uint64(1000*32<<20))
+			So(derived["derived/bytes_read"], ShouldEqual, uint64(3000*32<<20))
+
+			delete(values, "totallba/written")
+			values["hostwrites"] = uint64(5)
+			So(DeriveMetrics(values, "INTEL SSDSC2BA400G3")["derived/bytes_written"], ShouldEqual, uint64(5*32<<20))
+			So(DeriveMetrics(values, "ST4000NM0033"), ShouldNotContainKey, "derived/bytes_written")
+		})
+
+		Convey("Device statistics are preferred to attributes", func() {
+			values["devstats/general/sectorswritten"] = uint64(2)
+			values["sct/temperature/current"] = int64(-5)
+			derived := DeriveMetrics(values, "ST4000NM0033")
+			So(derived["derived/bytes_written"], ShouldEqual, uint64(1024))
+			So(derived["derived/temperature_celsius"], ShouldEqual, int64(-5))
+		})
+
+		Convey("Hours in other formats are converted", func() {
+			values["poweronhours"] = 1.5
+			So(DeriveMetrics(values, "")["derived/power_on_seconds"], ShouldEqual, 5400)
+		})
+
+		Convey("Large counters keep their precision", func() {
+			values["totallba/written"] = uint64(1<<53 + 1)
+			So(DeriveMetrics(values, "ST4000NM0033")["derived/bytes_written"], ShouldEqual, uint64(1<<53+1)*sector_bytes)
+			values["totallba/written"] = uint64(math.MaxUint64)
+			So(DeriveMetrics(values, "ST4000NM0033")["derived/bytes_written"], ShouldEqual, uint64(math.MaxUint64))
+		})
+
+	})
+
+	Convey("Deriving metrics of NVMe controller", t, func() {
+
+		log := NvmeSmartLog{Temperature: 300}
+		log.DataUnitsWritten[0] = 2
+		log.DataUnitsRead[0] = 1
+		log.PowerOnHours[0] = 1
+		derived := DeriveMetrics(log.GetAttributes(), "")
+
+		So(derived, ShouldResemble, map[string]interface{}{
+			"derived/bytes_written":       uint64(1024000),
+			"derived/bytes_read":          uint64(512000),
+			"derived/power_on_seconds":    uint64(3600),
+			"derived/temperature_celsius": int64(300 - kelvin_offset),
+		})
+
+	})
+
+	Convey("Every derived metric has unit", t, func() {
+		for _, key := range derivedKeys {
+			So(derivedUnits[key], ShouldNotBeEmpty)
+		}
+	})
+}
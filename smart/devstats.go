@@ -0,0 +1,224 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+)
+
+const (
+	device_statistics_log = 0x04
+
+	// Offset of number of entries in list of supported pages
+	devstat_supported_pages_offset = 8
+
+	// Flags of statistic
+	devstat_supported = 1 << 63
+	devstat_valid     = 1 << 62
+	devstat_value     = 1<<48 - 1
+)
+
+// Describes single statistic of Device Statistics log page. Signed values
+// take one byte, e.g. temperatures.
+type devstat struct {
+	Name   string
+	Signed bool
+}
+
+// Describes page of Device Statistics log, statistics are given by offset.
+type devstatPage struct {
+	Number byte
+	Prefix string
+	Stats  map[int]devstat
+}
+
+// Pages of Device Statistics log read from devices.
+var devstatPages = []devstatPage{
+	{0x01, "general/", map[int]devstat{
+		0x08: {"poweronresets", false},
+		0x10: {"poweronhours", false},
+		0x18: {"sectorswritten", false},
+		0x20: {"writecommands", false},
+		0x28: {"sectorsread", false},
+		0x30: {"readcommands", false},
+		0x38: {"timestamp", false},
+		0x40: {"pendingerrors", false},
+		0x48: {"workloadutilization", false},
+		0x50: {"utilizationrate", false},
+	}},
+	{0x02, "freefall/", map[int]devstat{
+		0x08: {"events", false},
+		0x10: {"overlimitshocks", false},
+	}},
+	{0x03, "rotatingmedia/", map[int]devstat{
+		0x08: {"spindlehours", false},
+		0x10: {"headflyinghours", false},
+		0x18: {"headloads", false},
+		0x20: {"reallocatedsectors", false},
+		0x28: {"readrecoveryattempts", false},
+		0x30: {"startfailures", false},
+		0x38: {"reallocationcandidates", false},
+		0x40: {"highpriorityunloads", false},
+	}},
+	{0x04, "generalerrors/", map[int]devstat{
+		0x08: {"uncorrectable", false},
+		0x10: {"commandresets", false},
+	}},
+	{0x05, "temperature/", map[int]devstat{
+		0x08: {"current", true},
+		0x10: {"average/shortterm", true},
+		0x18: {"average/longterm", true},
+		0x20: {"highest", true},
+		0x28: {"lowest", true},
+		0x30: {"average/shortterm/highest", true},
+		0x38: {"average/shortterm/lowest", true},
+		0x40: {"average/longterm/highest", true},
+		0x48: {"average/longterm/lowest", true},
+		0x50: {"overtemperatureminutes", false},
+		0x58: {"specifiedmax", true},
+		0x60: {"undertemperatureminutes", false},
+		0x68: {"specifiedmin", true},
+	}},
+	{0x07, "solidstate/", map[int]devstat{
+		0x08: {"percentageused", false},
+	}},
+}
+
+// DeviceStatistics holds pages of Device Statistics log read from device,
+// by page number.
+type DeviceStatistics map[byte][]byte
+
+// ParseSupportedDevstatPages decodes list of supported pages, which is
+// the first page of Device Statistics log.
+func ParseSupportedDevstatPages(data []byte) map[byte]bool {
+	pages := map[byte]bool{}
+	if len(data) < 512 {
+		return pages
+	}
+	end := devstat_supported_pages_offset + 1 + int(data[devstat_supported_pages_offset])
+	if end > 512 {
+		end = 512
+	}
+	for _, page := range data[devstat_supported_pages_offset+1 : end] {
+		pages[page] = true
+	}
+	return pages
+}
+
+// readDeviceStatistics reads all pages of Device Statistics log up to the
+// last supported one of those read by plugin, using given log reader.
+func readDeviceStatistics(readLog func(pages int) ([]byte, error)) (DeviceStatistics, error) {
+	data, err := readLog(1)
+	if err != nil {
+		return nil, err
+	}
+	supported := ParseSupportedDevstatPages(data)
+	last := 0
+	for _, page := range devstatPages {
+		if supported[page.Number] && int(page.Number) > last {
+			last = int(page.Number)
+		}
+	}
+	stats := DeviceStatistics{}
+	if last == 0 {
+		return stats, nil
+	}
+	if data, err = readLog(last + 1); err != nil {
+		return nil, err
+	}
+	for _, page := range devstatPages {
+		if !supported[page.Number] {
+			continue
+		}
+		content := data[int(page.Number)*512 : int(page.Number+1)*512]
+		// Page number is repeated in header of page
+		if content[2] == page.Number {
+			stats[page.Number] = content
+		}
+	}
+	return stats, nil
+}
+
+// ReadDeviceStatistics_ retrieves Device Statistics log using READ LOG EXT,
+// or SMART READ LOG if device does not support the former.
+func ReadDeviceStatistics_(device string, sysutilProvider SysutilProvider) (DeviceStatistics, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	transport := NewAtaTransport(sysutilProvider, device)
+	stats, err := readDeviceStatistics(func(pages int) ([]byte, error) {
+		return readLogExt(f.Fd(), transport, device_statistics_log, 0, pages)
+	})
+	if err == nil {
+		return stats, nil
+	}
+	stats, err = readDeviceStatistics(func(pages int) ([]byte, error) {
+		return readSmartLog(f.Fd(), transport, device_statistics_log, pages)
+	})
+	if err != nil {
+		return nil, readError(device, "device statistics reading", err)
+	}
+	return stats, nil
+}
+
+// Introduced to make mocking possible. See ReadDeviceStatistics_.
+var ReadDeviceStatistics = ReadDeviceStatistics_
+
+// GetAttributes transforms device statistics to map containing values of
+// supported and valid statistics. Values are accessed using
+// "devstats/[page]/[statistic]".
+func (s DeviceStatistics) GetAttributes() map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	for _, page := range devstatPages {
+		data, ok := s[page.Number]
+		if !ok {
+			continue
+		}
+		for offset, stat := range page.Stats {
+			qword := binary.LittleEndian.Uint64(data[offset : offset+8])
+			if qword&devstat_supported == 0 || qword&devstat_valid == 0 {
+				continue
+			}
+			key := "devstats/" + page.Prefix + stat.Name
+			if stat.Signed {
+				ret_val[key] = int64(int8(qword))
+			} else {
+				ret_val[key] = qword & devstat_value
+			}
+		}
+	}
+	return ret_val
+}
+
+// Returns list of keys that can be used to access values of all statistics.
+func listDevstatKeys() []string {
+	keys := []string{}
+	for _, page := range devstatPages {
+		for _, stat := range page.Stats {
+			keys = append(keys, "devstats/"+page.Prefix+stat.Name)
+		}
+	}
+	return keys
+}
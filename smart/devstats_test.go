@@ -0,0 +1,126 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func putDevstat(data []byte, page byte, offset int, flags uint64, value uint64) {
+	binary.LittleEndian.PutUint64(data[int(page)*512+offset:], flags|value)
+}
+
+// Device Statistics log with supported pages 0, 1, 5 and 7, where some
+// statistics are not valid or not supported.
+func devstatsFixture() []byte {
+	data := make([]byte, 8*512)
+	data[devstat_supported_pages_offset] = 4
+	copy(data[devstat_supported_pages_offset+1:], []byte{0x00, 0x01, 0x05, 0x07})
+	for _, page := range []byte{0x01, 0x05, 0x07} {
+		data[int(page)*512+2] = page
+	}
+	valid := uint64(devstat_supported | devstat_valid)
+	putDevstat(data, 0x01, 0x10, valid, 12345)
+	putDevstat(data, 0x01, 0x18, valid|1<<61, 0x0000123456789abc)
+	putDevstat(data, 0x01, 0x28, devstat_supported, 100)
+	putDevstat(data, 0x05, 0x08, valid, 0xfb)
+	putDevstat(data, 0x05, 0x58, valid, 70)
+	putDevstat(data, 0x07, 0x08, valid, 3)
+	// Page not supported by device
+	putDevstat(data, 0x04, 0x08, valid, 1)
+	return data
+}
+
+func TestDeviceStatistics(t *testing.T) {
+	Convey("Reading device statistics using READ LOG EXT", t, func() {
+
+		provider := &fakeLogProvider{
+			fakeSysutilProvider: fakeSysutilProvider{IoctlRets: []error{errors.New("EINVAL")}},
+			Logs:                map[byte][]byte{device_statistics_log: devstatsFixture()},
+		}
+		stats, err := ReadDeviceStatistics("MYDEV", provider)
+
+		Convey("Should read list of pages and then pages up to the last supported", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.LogArgs), ShouldEqual, 2)
+			So(provider.LogArgs[0].Cdb[6], ShouldEqual, 1)
+			So(provider.LogArgs[1].Cdb[6], ShouldEqual, 8)
+
+		})
+
+		Convey("Supported and valid statistics should be published", func() {
+
+			So(stats.GetAttributes(), ShouldResemble, map[string]interface{}{
+				"devstats/general/poweronhours":      uint64(12345),
+				"devstats/general/sectorswritten":    uint64(0x123456789abc),
+				"devstats/temperature/current":       int64(-5),
+				"devstats/temperature/specifiedmax":  int64(70),
+				"devstats/solidstate/percentageused": uint64(3),
+			})
+
+		})
+
+		Convey("Statistics should be advertised", func() {
+
+			So(ListAllKeys(), ShouldContain, "devstats/rotatingmedia/reallocatedsectors")
+			So(ListAllKeys(), ShouldContain, "devstats/generalerrors/uncorrectable")
+			So(ListAllKeys(), ShouldContain, "devstats/freefall/events")
+
+		})
+
+	})
+
+	Convey("Reading device statistics using SMART READ LOG", t, func() {
+
+		data := make([]byte, 512)
+		data[devstat_supported_pages_offset] = 1
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, device_statistics_log, smart_read_log, 1}, data...)}
+		stats, err := ReadDeviceStatistics("MYDEV", provider)
+
+		Convey("Device without supported pages has no statistics", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(stats, ShouldBeEmpty)
+
+		})
+
+	})
+
+	Convey("When device has no device statistics log", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{errors.New("EIO")}}
+		_, err := ReadDeviceStatistics("MYDEV", provider)
+
+		So(err, ShouldNotBeNil)
+
+	})
+}
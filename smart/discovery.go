@@ -0,0 +1,250 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DeviceClass tells how block device is attached, which determines SMART
+// transport usable for it.
+type DeviceClass int
+
+const (
+	ClassUnknown DeviceClass = iota
+	ClassAta
+	ClassScsi
+	ClassNvme
+	ClassVirtual
+	ClassPartition
+	ClassLoop
+)
+
+// SCSI peripheral device types of disks
+const (
+	scsi_type_disk  = 0x00
+	scsi_type_zoned = 0x14
+)
+
+// Prefixes of names of virtual block devices.
+var virtualDevicePrefixes = []string{"vd", "xvd", "dm-", "md", "zd", "rbd", "nbd"}
+
+// Prefixes of names of memory and file backed block devices.
+var loopDevicePrefixes = []string{"loop", "ram", "zram"}
+
+func readSysfsAttr(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func hasPrefix(name string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// sysfsPath returns default path of sysfs, which is expected next to
+// procfs at given path, e.g. /sys for /proc or /host/sys for /host/proc.
+func sysfsPath(procPath string) string {
+	return filepath.Join(filepath.Dir(filepath.Clean(procPath)), "sys")
+}
+
+// ClassifyBlockDevice classifies block device with given name, which
+// directory is in given sysfs block directory (e.g. /sys/block).
+func ClassifyBlockDevice(sysBlock string, name string) DeviceClass {
+	dir := filepath.Join(sysBlock, name)
+	switch {
+	case hasPrefix(name, loopDevicePrefixes):
+		return ClassLoop
+	case hasPrefix(name, virtualDevicePrefixes):
+		return ClassVirtual
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		return ClassPartition
+	}
+	if nvmeNamespaceRe.MatchString(name) {
+		return ClassNvme
+	}
+	// Devices not backed by hardware have no device link
+	if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+		return ClassVirtual
+	}
+	if strings.HasPrefix(name, "hd") {
+		return ClassAta
+	}
+	if !strings.HasPrefix(name, "sd") {
+		return ClassUnknown
+	}
+	// Only disks are queried, not e.g. optical drives or enclosures
+	kind, err := strconv.Atoi(readSysfsAttr(filepath.Join(dir, "device", "type")))
+	if err != nil || (kind != scsi_type_disk && kind != scsi_type_zoned) {
+		return ClassUnknown
+	}
+	// libata reports ATA as vendor of disks it translates SCSI commands for
+	if readSysfsAttr(filepath.Join(dir, "device", "vendor")) == "ATA" {
+		return ClassAta
+	}
+	return ClassScsi
+}
+
+// listSysfsDevices lists devices with usable SMART transport found in
+// given sysfs block directory. NVMe namespaces are reported as their
+// controllers, once per controller.
+func listSysfsDevices(sysBlock string) ([]string, error) {
+	entries, err := ioutil.ReadDir(sysBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	nvme_controllers := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch ClassifyBlockDevice(sysBlock, name) {
+		case ClassAta, ClassScsi:
+			result = append(result, name)
+		case ClassNvme:
+			// SMART log is per controller
+			controller := controllerName(name)
+			if !nvme_controllers[controller] {
+				nvme_controllers[controller] = true
+				result = append(result, controller)
+			}
+		}
+	}
+	return result, nil
+}
+
+// controllerName returns name of device queried for SMART data of given
+// block device, i.e. controller of NVMe namespace or device itself.
+func controllerName(name string) string {
+	if m := nvmeNamespaceRe.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return name
+}
+
+// readVpdSerial returns serial number from unit serial number VPD page
+// exported by kernel.
+func readVpdSerial(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) < 4 {
+		return ""
+	}
+	return strings.TrimSpace(string(data[4:]))
+}
+
+// ReadDeviceInfo_ gathers names of device found in sysfs and in by-id
+// links, without opening the device.
+func ReadDeviceInfo_(sysPath, devPath, name string) DeviceInfo {
+	info := DeviceInfo{Name: name}
+	if strings.HasPrefix(name, "nvme") {
+		dir := filepath.Join(sysPath, "class", "nvme", name)
+		info.Model = readSysfsAttr(filepath.Join(dir, "model"))
+		info.Serial = readSysfsAttr(filepath.Join(dir, "serial"))
+	} else {
+		dir := filepath.Join(sysPath, "block", name, "device")
+		info.Model = readSysfsAttr(filepath.Join(dir, "model"))
+		info.Serial = readVpdSerial(filepath.Join(dir, "vpd_pg80"))
+	}
+
+	info.ById = ListDeviceLinks(devPath, linksById, name)
+	return info
+}
+
+// Introduced to make mocking possible. See ReadDeviceInfo_.
+var ReadDeviceInfo = ReadDeviceInfo_
+
+// Directories of persistent device links in dev_path/disk
+const (
+	linksById   = "by-id"
+	linksByPath = "by-path"
+)
+
+// ListDeviceLinks returns sorted names of links in given directory of
+// dev_path/disk, which point to given device (or to namespaces of given
+// NVMe controller). Links to partitions are omitted.
+func ListDeviceLinks(devPath, kind, name string) []string {
+	dir := filepath.Join(devPath, "disk", kind)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	result := []string{}
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if controllerName(filepath.Base(target)) == name {
+			result = append(result, entry.Name())
+		}
+	}
+	return result
+}
+
+// ResolveDeviceLink returns name of device queried for SMART data, which
+// given link in dev_path/disk/by-id or dev_path/disk/by-path points to.
+func ResolveDeviceLink(devPath, link string) (string, bool) {
+	for _, kind := range []string{linksById, linksByPath} {
+		target, err := os.Readlink(filepath.Join(devPath, "disk", kind, link))
+		if err == nil {
+			return controllerName(filepath.Base(target)), true
+		}
+	}
+	return "", false
+}
+
+// preferredIdLink chooses by-id link naming device: links with model and
+// serial number are preferred to ones with WWN or EUI, which are less
+// readable and are available via wwn naming.
+func preferredIdLink(links []string) string {
+	for _, link := range links {
+		if !strings.HasPrefix(link, "wwn-") && !strings.Contains(link, "eui.") {
+			return link
+		}
+	}
+	if len(links) > 0 {
+		return links[0]
+	}
+	return ""
+}
+
+// wwnFromLinks returns WWN given in name of wwn- link in by-id directory.
+func wwnFromLinks(links []string) string {
+	for _, link := range links {
+		if strings.HasPrefix(link, "wwn-") {
+			return strings.TrimPrefix(link, "wwn-")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// makeSysBlock creates fake sysfs block directory with given devices;
+// nil attributes mean device without device link.
+func makeSysBlock(dir string, devices map[string]map[string]string) string {
+	sysBlock := filepath.Join(dir, "block")
+	for name, attrs := range devices {
+		devDir := filepath.Join(sysBlock, name)
+		So(os.MkdirAll(devDir, 0755), ShouldBeNil)
+		for attr, value := range attrs {
+			path := filepath.Join(devDir, attr)
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte(value+"\n"), 0644), ShouldBeNil)
+		}
+	}
+	return sysBlock
+}
+
+func TestSysfsDiscovery(t *testing.T) {
+	Convey("Discovering devices in sysfs", t, func() {
+
+		dir, err := ioutil.TempDir("", "smart")
+		So(err, ShouldBeNil)
+
+		sysBlock := makeSysBlock(filepath.Join(dir, "sys"), map[string]map[string]string{
+			"sda":     {"device/type": "0", "device/vendor": "ATA     "},
+			"sdb":     {"device/type": "0", "device/vendor": "SEAGATE "},
+			"sdc":     {"device/type": "20", "device/vendor": "HGST"},
+			"sr0":     {"device/type": "5", "device/vendor": "HL-DT-ST"},
+			"sdd":     {"device/type": "5", "device/vendor": "ATA"},
+			"hda":     {"device/model": "disk"},
+			"sda1":    {"partition": "1"},
+			"nvme0n1": {"device/model": "ssd"},
+			"nvme0n2": {"device/model": "ssd"},
+			"nvme1n1": {"device/model": "ssd"},
+			"vda":     {"device/vendor": "0x1af4"},
+			"dm-0":    nil,
+			"md127":   nil,
+			"loop0":   nil,
+			"zram0":   nil,
+		})
+
+		Convey("Should classify devices", func() {
+
+			classes := map[string]DeviceClass{
+				"sda":     ClassAta,
+				"sdb":     ClassScsi,
+				"sdc":     ClassScsi,
+				"sr0":     ClassUnknown,
+				"sdd":     ClassUnknown,
+				"hda":     ClassAta,
+				"sda1":    ClassPartition,
+				"nvme0n1": ClassNvme,
+				"vda":     ClassVirtual,
+				"dm-0":    ClassVirtual,
+				"md127":   ClassVirtual,
+				"loop0":   ClassLoop,
+				"zram0":   ClassLoop,
+			}
+			for name, class := range classes {
+				So(ClassifyBlockDevice(sysBlock, name), ShouldEqual, class)
+			}
+
+		})
+
+		Convey("Should list disks and NVMe controllers", func() {
+
+			devices, err := NewSysutilProvider(filepath.Join(dir, "proc"), "/dev", filepath.Join(dir, "sys")).ListDevices()
+			So(err, ShouldBeNil)
+			So(devices, ShouldResemble, []string{"hda", "nvme0", "nvme1", "sda", "sdb", "sdc"})
+
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+	})
+}
+
+func TestSysfsPath(t *testing.T) {
+	Convey("Sysfs should be found next to procfs", t, func() {
+
+		So(sysfsPath("/proc"), ShouldEqual, "/sys")
+		So(sysfsPath("/host/proc/"), ShouldEqual, "/host/sys")
+
+	})
+}
+
+func TestReadDeviceInfo(t *testing.T) {
+	Convey("Reading names of device", t, func() {
+
+		dir, err := ioutil.TempDir("", "smart")
+		So(err, ShouldBeNil)
+
+		makeSysBlock(dir, map[string]map[string]string{
+			"sda": {"device/model": "ST4000NM0033    ", "device/vpd_pg80": "\x00\x80\x00\x08    Z1Z0"},
+		})
+		So(os.MkdirAll(filepath.Join(dir, "class", "nvme", "nvme0"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "class", "nvme", "nvme0", "serial"), []byte("S3EV  \n"), 0644), ShouldBeNil)
+
+		byId := filepath.Join(dir, "disk", "by-id")
+		So(os.MkdirAll(byId, 0755), ShouldBeNil)
+		for link, target := range map[string]string{
+			"ata-ST4000NM0033_Z1Z0":       "../../sda",
+			"ata-ST4000NM0033_Z1Z0-part1": "../../sda1",
+			"wwn-0x5000c500":              "../../sda",
+			"nvme-Samsung_S3EV":           "../../nvme0n1",
+		} {
+			So(os.Symlink(target, filepath.Join(byId, link)), ShouldBeNil)
+		}
+
+		Convey("Should read names of disk", func() {
+			So(ReadDeviceInfo_(dir, dir, "sda"), ShouldResemble, DeviceInfo{
+				Name:   "sda",
+				Model:  "ST4000NM0033",
+				Serial: "Z1Z0",
+				ById:   []string{"ata-ST4000NM0033_Z1Z0", "wwn-0x5000c500"},
+			})
+		})
+
+		Convey("Should resolve persistent links", func() {
+			So(ListDeviceLinks(dir, "by-path", "sda"), ShouldBeEmpty)
+			So(preferredIdLink(ListDeviceLinks(dir, "by-id", "sda")), ShouldEqual, "ata-ST4000NM0033_Z1Z0")
+			So(preferredIdLink([]string{"nvme-eui.0025", "wwn-0x5000c500"}), ShouldEqual, "nvme-eui.0025")
+			So(wwnFromLinks(ListDeviceLinks(dir, "by-id", "sda")), ShouldEqual, "0x5000c500")
+
+			disk, ok := ResolveDeviceLink(dir, "nvme-Samsung_S3EV")
+			So(ok, ShouldBeTrue)
+			So(disk, ShouldEqual, "nvme0")
+			_, ok = ResolveDeviceLink(dir, "sda")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Should read names of NVMe controller", func() {
+			So(ReadDeviceInfo_(dir, dir, "nvme0"), ShouldResemble, DeviceInfo{
+				Name:   "nvme0",
+				Serial: "S3EV",
+				ById:   []string{"nvme-Samsung_S3EV"},
+			})
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+
+	})
+}
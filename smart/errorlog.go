@@ -0,0 +1,199 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Log addresses
+	smart_summary_error_log     = 0x01
+	ext_comprehensive_error_log = 0x03
+
+	summary_error_entries        = 5
+	summary_error_entry_length   = 90
+	summary_error_data_offset    = 60
+	summary_error_count_offset   = 452
+	ext_error_entries_per_page   = 4
+	ext_error_entry_length       = 124
+	ext_error_data_offset        = 90
+	ext_error_count_offset       = 500
+	ext_error_descriptors_offset = 4
+)
+
+// ErrorLogEntry describes the most recent ATA command error logged by
+// device. Hours is device lifetime in power-on hours when error occurred.
+type ErrorLogEntry struct {
+	Status byte
+	Error  byte
+	Lba    uint64
+	Hours  uint16
+}
+
+// ErrorLog holds total number of errors reported by device and the most
+// recent of them, if there is any.
+type ErrorLog struct {
+	Count uint16
+	Last  *ErrorLogEntry
+}
+
+// Keys of values published for error log, see ErrorLog.GetAttributes.
+var errorLogKeys = []string{
+	"errorlog/count",
+	"errorlog/last/hours",
+	"errorlog/last/status",
+	"errorlog/last/error",
+	"errorlog/last/lba",
+}
+
+// Key of number of errors logged since previous reading of error log.
+var errorLogDeltaKey = "errorlog/new"
+
+// ParseSummaryErrorLog decodes SMART summary error log, which keeps 5
+// most recent errors with 28-bit LBA.
+func ParseSummaryErrorLog(data []byte) (*ErrorLog, error) {
+	if len(data) < 512 {
+		return nil, errors.New("Summary error log too short")
+	}
+
+	log := &ErrorLog{Count: binary.LittleEndian.Uint16(data[summary_error_count_offset:])}
+	index := int(data[1])
+	if index == 0 || index > summary_error_entries {
+		return log, nil
+	}
+	e := data[2+(index-1)*summary_error_entry_length+summary_error_data_offset:]
+	log.Last = &ErrorLogEntry{
+		Error:  e[1],
+		Status: e[7],
+		Lba:    uint64(e[3]) | uint64(e[4])<<8 | uint64(e[5])<<16 | uint64(e[6]&0x0f)<<24,
+		Hours:  binary.LittleEndian.Uint16(e[28:30]),
+	}
+
+	return log, nil
+}
+
+// ParseExtErrorLog decodes page of extended comprehensive error log, which
+// keeps 4 errors with 48-bit LBA per page. Index of the most recent error
+// and error count are only valid in the first page, see ExtErrorLogPage.
+func ParseExtErrorLog(data []byte, index int, count uint16) (*ErrorLog, error) {
+	if len(data) < 512 {
+		return nil, errors.New("Extended comprehensive error log too short")
+	}
+
+	log := &ErrorLog{Count: count}
+	if index == 0 {
+		return log, nil
+	}
+	i := (index - 1) % ext_error_entries_per_page
+	e := data[ext_error_descriptors_offset+i*ext_error_entry_length+ext_error_data_offset:]
+	log.Last = &ErrorLogEntry{
+		Error:  e[1],
+		Status: e[11],
+		Lba: uint64(e[4]) | uint64(e[6])<<8 | uint64(e[8])<<16 |
+			uint64(e[5])<<24 | uint64(e[7])<<32 | uint64(e[9])<<40,
+		Hours: binary.LittleEndian.Uint16(e[32:34]),
+	}
+
+	return log, nil
+}
+
+// ExtErrorLogPage returns index of the most recent error given in the first
+// page of extended comprehensive error log and page on which it is.
+func ExtErrorLogPage(data []byte) (int, int) {
+	index := int(binary.LittleEndian.Uint16(data[2:4]))
+	if index == 0 {
+		return 0, 0
+	}
+	return index, (index - 1) / ext_error_entries_per_page
+}
+
+// ExtErrorLogCount returns device error count given in the first page of
+// extended comprehensive error log.
+func ExtErrorLogCount(data []byte) uint16 {
+	return binary.LittleEndian.Uint16(data[ext_error_count_offset:])
+}
+
+func readExtErrorLog(fd uintptr, transport AtaTransport) (*ErrorLog, error) {
+	pages, err := readGplLogPages(fd, transport, ext_comprehensive_error_log)
+	if err != nil {
+		return nil, err
+	}
+	if pages == 0 {
+		return nil, unsupportedError("Extended comprehensive error log not supported")
+	}
+	data, err := readLogExt(fd, transport, ext_comprehensive_error_log, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	count := ExtErrorLogCount(data)
+	index, page := ExtErrorLogPage(data)
+	if page >= pages {
+		return nil, errors.New(fmt.Sprintf("Error log index %d out of %d pages", index, pages))
+	}
+	if page > 0 {
+		if data, err = readLogExt(fd, transport, ext_comprehensive_error_log, byte(page), 1); err != nil {
+			return nil, err
+		}
+	}
+	return ParseExtErrorLog(data, index, count)
+}
+
+// ReadErrorLog_ retrieves extended comprehensive error log from device, or
+// SMART summary error log if device does not support the former.
+func ReadErrorLog_(device string, sysutilProvider SysutilProvider) (*ErrorLog, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	transport := NewAtaTransport(sysutilProvider, device)
+	if log, err := readExtErrorLog(f.Fd(), transport); err == nil {
+		return log, nil
+	}
+
+	data, err := readSmartLog(f.Fd(), transport, smart_summary_error_log, 1)
+	if err != nil {
+		return nil, readError(device, "S.M.A.R.T error log reading", err)
+	}
+	return ParseSummaryErrorLog(data)
+}
+
+// Introduced to make mocking possible. See ReadErrorLog_.
+var ReadErrorLog = ReadErrorLog_
+
+// GetAttributes transforms error log to map containing number of errors
+// and values describing the most recent error, if there is any.
+func (l ErrorLog) GetAttributes() map[string]interface{} {
+	ret_val := map[string]interface{}{"errorlog/count": uint64(l.Count)}
+	if l.Last == nil {
+		return ret_val
+	}
+	ret_val["errorlog/last/hours"] = uint64(l.Last.Hours)
+	ret_val["errorlog/last/status"] = uint64(l.Last.Status)
+	ret_val["errorlog/last/error"] = uint64(l.Last.Error)
+	ret_val["errorlog/last/lba"] = l.Last.Lba
+	return ret_val
+}
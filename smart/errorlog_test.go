@@ -0,0 +1,190 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// SMART summary error log with 7 errors, the most recent one in second
+// entry: uncorrectable error on LBA 0x0abcdef at 1234 hours.
+func summaryErrorLogFixture() []byte {
+	data := make([]byte, 512)
+	data[0], data[1] = 1, 2
+	e := data[2+summary_error_entry_length+summary_error_data_offset:]
+	e[1], e[3], e[4], e[5], e[6], e[7] = 0x40, 0xef, 0xcd, 0xab, 0xe0, 0x51
+	binary.LittleEndian.PutUint16(e[28:30], 1234)
+	binary.LittleEndian.PutUint16(data[summary_error_count_offset:], 7)
+	return data
+}
+
+// Extended comprehensive error log with 9 errors and the most recent one
+// at given index: ID not found on LBA 0x123456789abc at 4321 hours. Index
+// and error count are set in the first page only.
+func extErrorLogFixture(index, pages int) []byte {
+	data := make([]byte, pages*512)
+	data[0] = 1
+	binary.LittleEndian.PutUint16(data[2:4], uint16(index))
+	binary.LittleEndian.PutUint16(data[ext_error_count_offset:], 9)
+	page, slot := (index-1)/ext_error_entries_per_page, (index-1)%ext_error_entries_per_page
+	e := data[page*512+ext_error_descriptors_offset+slot*ext_error_entry_length+ext_error_data_offset:]
+	e[1], e[11] = 0x10, 0x51
+	e[4], e[6], e[8], e[5], e[7], e[9] = 0xbc, 0x9a, 0x78, 0x56, 0x34, 0x12
+	binary.LittleEndian.PutUint16(e[32:34], 4321)
+	return data
+}
+
+func TestParseErrorLog(t *testing.T) {
+	Convey("Decoding SMART summary error log", t, func() {
+
+		log, err := ParseSummaryErrorLog(summaryErrorLogFixture())
+
+		So(err, ShouldBeNil)
+		So(log.Count, ShouldEqual, 7)
+		So(*log.Last, ShouldResemble, ErrorLogEntry{Status: 0x51, Error: 0x40, Lba: 0x0abcdef, Hours: 1234})
+
+		Convey("Values of the most recent error are published", func() {
+
+			So(log.GetAttributes(), ShouldResemble, map[string]interface{}{
+				"errorlog/count":       uint64(7),
+				"errorlog/last/hours":  uint64(1234),
+				"errorlog/last/status": uint64(0x51),
+				"errorlog/last/error":  uint64(0x40),
+				"errorlog/last/lba":    uint64(0x0abcdef),
+			})
+
+		})
+
+	})
+
+	Convey("Decoding empty SMART summary error log", t, func() {
+
+		log, err := ParseSummaryErrorLog(make([]byte, 512))
+
+		So(err, ShouldBeNil)
+		So(log.Last, ShouldBeNil)
+		So(log.GetAttributes(), ShouldResemble, map[string]interface{}{"errorlog/count": uint64(0)})
+
+	})
+
+	Convey("Decoding extended comprehensive error log", t, func() {
+
+		data := extErrorLogFixture(6, 2)
+		index, page := ExtErrorLogPage(data)
+
+		So(index, ShouldEqual, 6)
+		So(page, ShouldEqual, 1)
+		So(ExtErrorLogCount(data), ShouldEqual, 9)
+
+		log, err := ParseExtErrorLog(data[512:], index, ExtErrorLogCount(data))
+
+		So(err, ShouldBeNil)
+		So(log.Count, ShouldEqual, 9)
+		So(*log.Last, ShouldResemble, ErrorLogEntry{Status: 0x51, Error: 0x10, Lba: 0x123456789abc, Hours: 4321})
+
+	})
+
+	Convey("Decoding truncated error logs", t, func() {
+
+		_, err := ParseSummaryErrorLog(make([]byte, 100))
+		So(err, ShouldNotBeNil)
+		_, err = ParseExtErrorLog(make([]byte, 100), 1, 1)
+		So(err, ShouldNotBeNil)
+
+	})
+}
+
+func TestReadErrorLog(t *testing.T) {
+	Convey("Reading error log of device supporting extended log", t, func() {
+
+		directory := make([]byte, 512)
+		binary.LittleEndian.PutUint16(directory[2*ext_comprehensive_error_log:], 2)
+
+		provider := &fakeLogProvider{
+			fakeSysutilProvider: fakeSysutilProvider{IoctlRets: []error{errors.New("EINVAL")}},
+			Logs: map[byte][]byte{
+				gpl_log_directory:           directory,
+				ext_comprehensive_error_log: extErrorLogFixture(2, 1),
+			},
+		}
+		log, err := ReadErrorLog("MYDEV", provider)
+
+		Convey("Should read it using READ LOG EXT", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.LogArgs), ShouldEqual, 2)
+			So(provider.LogArgs[1].Cdb[14], ShouldEqual, ata_read_log_ext)
+			So(log.Count, ShouldEqual, 9)
+			So(log.Last.Lba, ShouldEqual, 0x123456789abc)
+
+		})
+
+	})
+
+	Convey("Reading error log with the most recent error past the first page", t, func() {
+
+		directory := make([]byte, 512)
+		binary.LittleEndian.PutUint16(directory[2*ext_comprehensive_error_log:], 2)
+
+		provider := &fakeLogProvider{
+			fakeSysutilProvider: fakeSysutilProvider{IoctlRets: []error{errors.New("EINVAL")}},
+			Logs: map[byte][]byte{
+				gpl_log_directory:           directory,
+				ext_comprehensive_error_log: extErrorLogFixture(6, 2),
+			},
+		}
+		log, err := ReadErrorLog("MYDEV", provider)
+
+		Convey("Should read the second page and take error count from the first", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.LogArgs), ShouldEqual, 3)
+			So(provider.LogArgs[2].Cdb[10], ShouldEqual, 1)
+			So(log.Count, ShouldEqual, 9)
+			So(*log.Last, ShouldResemble, ErrorLogEntry{Status: 0x51, Error: 0x10, Lba: 0x123456789abc, Hours: 4321})
+
+		})
+
+	})
+
+	Convey("Reading error log of device without extended log", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, smart_summary_error_log, smart_read_log, 1}, summaryErrorLogFixture()...)}
+		log, err := ReadErrorLog("MYDEV", provider)
+
+		Convey("Should read it using SMART READ LOG", func() {
+
+			So(err, ShouldBeNil)
+			So(provider.IoctlArgs[0].buf[1], ShouldEqual, smart_summary_error_log)
+			So(log.Count, ShouldEqual, 7)
+
+		})
+
+	})
+}
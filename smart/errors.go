@@ -0,0 +1,117 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"fmt"
+)
+
+// ErrorCode classifies failure of reading device. Codes are published as
+// collector/error_code metric, so their values must not change.
+type ErrorCode int
+
+const (
+	ErrorNone ErrorCode = iota
+	// Device could not be opened
+	ErrorOpenFailed
+	// Command was rejected by kernel or failed on device
+	ErrorIoctlFailed
+	// Device does not support command or data structure
+	ErrorUnsupported
+	// Data structure read from device has invalid checksum
+	ErrorChecksum
+	// Failure of other kind
+	ErrorOther
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrorNone:        "none",
+	ErrorOpenFailed:  "open failed",
+	ErrorIoctlFailed: "ioctl failed",
+	ErrorUnsupported: "unsupported",
+	ErrorChecksum:    "checksum",
+	ErrorOther:       "other",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// DeviceError describes failure of reading device. Device is empty for
+// failures of single commands, which are wrapped by failures of reads.
+type DeviceError struct {
+	Code    ErrorCode
+	Device  string
+	Message string
+	Err     error
+}
+
+func (e *DeviceError) Error() string {
+	msg := e.Message
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s, error = %v", msg, e.Err)
+	}
+	if e.Device != "" {
+		msg = e.Device + ": " + msg
+	}
+	return msg
+}
+
+// ErrorCodeOf returns code of given error, ErrorOther if error is not
+// DeviceError.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ErrorNone
+	}
+	if e, ok := err.(*DeviceError); ok {
+		return e.Code
+	}
+	return ErrorOther
+}
+
+func openError(device string) error {
+	return &DeviceError{Code: ErrorOpenFailed, Device: device, Message: "Can't open device"}
+}
+
+// readError describes failure of given read from device, classified by
+// cause: unsupported commands and invalid checksums retain their codes,
+// other failures are failed ioctls.
+func readError(device string, what string, err error) error {
+	code := ErrorCodeOf(err)
+	if code != ErrorUnsupported && code != ErrorChecksum {
+		code = ErrorIoctlFailed
+	}
+	return &DeviceError{Code: code, Device: device, Message: what + " failed", Err: err}
+}
+
+// corruptError describes data structure read from device, which failed
+// validation.
+func corruptError(format string, a ...interface{}) error {
+	return &DeviceError{Code: ErrorChecksum, Message: "Corrupt " + fmt.Sprintf(format, a...)}
+}
+
+// unsupportedError describes command or data structure not supported by
+// device.
+func unsupportedError(format string, a ...interface{}) error {
+	return &DeviceError{Code: ErrorUnsupported, Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,68 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeviceError(t *testing.T) {
+	Convey("Classifying errors", t, func() {
+
+		Convey("Errors other than DeviceError are not classified", func() {
+			So(ErrorCodeOf(nil), ShouldEqual, ErrorNone)
+			So(ErrorCodeOf(errors.New("x")), ShouldEqual, ErrorOther)
+		})
+
+		Convey("Failed device opening is reported", func() {
+			err := openError("sda")
+			So(ErrorCodeOf(err), ShouldEqual, ErrorOpenFailed)
+			So(err.Error(), ShouldEqual, "sda: Can't open device")
+		})
+
+		Convey("Failed reads retain code of unsupported command", func() {
+			err := readError("sda", "S.M.A.R.T Reading", unsupportedError("Command not supported by any transport"))
+			So(ErrorCodeOf(err), ShouldEqual, ErrorUnsupported)
+			So(err.Error(), ShouldEqual, "sda: S.M.A.R.T Reading failed, error = Command not supported by any transport")
+
+			err = readError("sda", "S.M.A.R.T Reading", errors.New("EIO"))
+			So(ErrorCodeOf(err), ShouldEqual, ErrorIoctlFailed)
+		})
+
+		Convey("Illegal SCSI requests are not supported", func() {
+			sense := []byte{sense_fixed_current, 0, sense_key_illegal_request}
+			So(ErrorCodeOf(scsiStatusError("LOG SENSE", scsi_status_check_condition, sense)), ShouldEqual, ErrorUnsupported)
+			sense[2] = 0x03
+			So(ErrorCodeOf(scsiStatusError("LOG SENSE", scsi_status_check_condition, sense)), ShouldEqual, ErrorIoctlFailed)
+		})
+
+		Convey("Codes are named", func() {
+			So(ErrorChecksum.String(), ShouldEqual, "checksum")
+			So(ErrorCode(42).String(), ShouldEqual, "ErrorCode(42)")
+		})
+
+	})
+}
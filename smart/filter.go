@@ -0,0 +1,143 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DeviceInfo describes device by names it can be filtered by, gathered
+// without opening the device. Empty values are unknown.
+type DeviceInfo struct {
+	Name   string
+	Model  string
+	Serial string
+	ById   []string
+}
+
+// Candidates returns all known names of device.
+func (info DeviceInfo) Candidates() []string {
+	result := []string{}
+	for _, s := range append([]string{info.Name, info.Model, info.Serial}, info.ById...) {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// devicePattern matches names of devices. Patterns enclosed in slashes are
+// regular expressions, others are shell globs.
+type devicePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func parseDevicePattern(s string) (devicePattern, error) {
+	if len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return devicePattern{}, errors.New(fmt.Sprintf("Invalid device pattern %s: %v", s, err))
+		}
+		return devicePattern{re: re}, nil
+	}
+	if _, err := path.Match(s, ""); err != nil {
+		return devicePattern{}, errors.New(fmt.Sprintf("Invalid device pattern %s: %v", s, err))
+	}
+	return devicePattern{glob: s}, nil
+}
+
+func (p devicePattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+// DeviceFilter selects devices queried when all devices are requested.
+type DeviceFilter struct {
+	include []devicePattern
+	exclude []devicePattern
+}
+
+func parseDevicePatterns(s string) ([]devicePattern, error) {
+	result := []devicePattern{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, err := parseDevicePattern(entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pattern)
+	}
+	return result, nil
+}
+
+// ParseDeviceFilter parses lists of include and exclude patterns, separated
+// by semicolons, e.g. "sd*; /^nvme[0-9]+$/". Empty include list includes
+// all devices.
+func ParseDeviceFilter(include, exclude string) (*DeviceFilter, error) {
+	var err error
+	filter := &DeviceFilter{}
+	if filter.include, err = parseDevicePatterns(include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = parseDevicePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func matchesAny(patterns []devicePattern, candidates []string) bool {
+	for _, p := range patterns {
+		for _, c := range candidates {
+			if p.matches(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Empty returns true if filter selects all devices.
+func (f *DeviceFilter) Empty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0)
+}
+
+// Allows returns true if device is matched by some include pattern (or
+// there are none) and by no exclude pattern.
+func (f *DeviceFilter) Allows(info DeviceInfo) bool {
+	if f.Empty() {
+		return true
+	}
+	candidates := info.Candidates()
+	if len(f.include) > 0 && !matchesAny(f.include, candidates) {
+		return false
+	}
+	return !matchesAny(f.exclude, candidates)
+}
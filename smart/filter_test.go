@@ -0,0 +1,75 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeviceFilter(t *testing.T) {
+	Convey("Filtering devices", t, func() {
+
+		sda := DeviceInfo{Name: "sda", Model: "ST4000NM0033", Serial: "Z1Z0", ById: []string{"ata-ST4000NM0033_Z1Z0"}}
+		sdb := DeviceInfo{Name: "sdb", Model: "Cruzer Blade", ById: []string{"usb-SanDisk_Cruzer_Blade-0:0"}}
+		nvme0 := DeviceInfo{Name: "nvme0", Serial: "S3EV"}
+
+		Convey("Empty filter allows all devices", func() {
+			filter, err := ParseDeviceFilter("", " ; ")
+			So(err, ShouldBeNil)
+			So(filter.Empty(), ShouldBeTrue)
+			So(filter.Allows(sda), ShouldBeTrue)
+			So((*DeviceFilter)(nil).Allows(sdb), ShouldBeTrue)
+		})
+
+		Convey("Globs are matched against all names", func() {
+			filter, err := ParseDeviceFilter("", "usb-*")
+			So(err, ShouldBeNil)
+			So(filter.Allows(sda), ShouldBeTrue)
+			So(filter.Allows(sdb), ShouldBeFalse)
+
+			filter, err = ParseDeviceFilter("ST4000*; S3EV", "")
+			So(err, ShouldBeNil)
+			So(filter.Allows(sda), ShouldBeTrue)
+			So(filter.Allows(sdb), ShouldBeFalse)
+			So(filter.Allows(nvme0), ShouldBeTrue)
+		})
+
+		Convey("Patterns in slashes are regular expressions", func() {
+			filter, err := ParseDeviceFilter("/^(sd|nvme)/", "/^Z1Z/")
+			So(err, ShouldBeNil)
+			So(filter.Allows(sda), ShouldBeFalse)
+			So(filter.Allows(sdb), ShouldBeTrue)
+			So(filter.Allows(nvme0), ShouldBeTrue)
+		})
+
+		Convey("Invalid patterns are rejected", func() {
+			_, err := ParseDeviceFilter("/sd(/", "")
+			So(err, ShouldNotBeNil)
+			_, err = ParseDeviceFilter("", "sd[")
+			So(err, ShouldNotBeNil)
+		})
+
+	})
+}
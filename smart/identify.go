@@ -0,0 +1,245 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ata_identify_device = 0xec
+
+	nvme_admin_identify      = 0x06
+	nvme_identify_controller = 0x01
+	nvme_identify_size       = 4096
+
+	scsi_inquiry            = 0x12
+	scsi_inquiry_length     = 96
+	scsi_vpd_length         = 252
+	scsi_vpd_serial_number  = 0x80
+	scsi_vpd_identification = 0x83
+	scsi_service_action_in  = 0x9e
+	scsi_read_capacity_16   = 0x10
+	scsi_capacity_length    = 32
+
+	// Designator type and association in device identification VPD page
+	scsi_designator_naa           = 0x03
+	scsi_association_logical_unit = 0x00
+)
+
+// DeviceIdentity describes physical drive independently of its kernel name.
+// Capacity is given in bytes, empty or zero values are unknown.
+type DeviceIdentity struct {
+	Model    string
+	Serial   string
+	Firmware string
+	Wwn      string
+	Capacity uint64
+}
+
+// Tags returns identity as metric tags, unknown values are omitted.
+func (id DeviceIdentity) Tags() map[string]string {
+	tags := map[string]string{}
+	for k, v := range map[string]string{
+		"model":    id.Model,
+		"serial":   id.Serial,
+		"firmware": id.Firmware,
+		"wwn":      id.Wwn,
+	} {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	if id.Capacity > 0 {
+		tags["capacity"] = strconv.FormatUint(id.Capacity, 10)
+	}
+	return tags
+}
+
+// ataString decodes ATA string, which has bytes swapped in every word.
+func ataString(data []byte) string {
+	buf := make([]byte, len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		buf[i], buf[i+1] = data[i+1], data[i]
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// ParseAtaIdentity decodes IDENTIFY DEVICE data.
+func ParseAtaIdentity(data []byte) DeviceIdentity {
+	word := func(i int) uint64 {
+		return uint64(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+
+	id := DeviceIdentity{
+		Serial:   ataString(data[20:40]),
+		Firmware: ataString(data[46:54]),
+		Model:    ataString(data[54:94]),
+	}
+
+	// 48-bit address feature set supported
+	sectors := word(60) | word(61)<<16
+	if word(83)&(1<<10) != 0 {
+		sectors = word(100) | word(101)<<16 | word(102)<<32 | word(103)<<48
+	}
+	// Logical sector longer than 256 words
+	sector_size := uint64(512)
+	if word(106)&0xc000 == 0x4000 && word(106)&(1<<12) != 0 {
+		sector_size = 2 * (word(117) | word(118)<<16)
+	}
+	id.Capacity = sectors * sector_size
+
+	if word(87)&0xc000 == 0x4000 && word(87)&(1<<8) != 0 {
+		id.Wwn = fmt.Sprintf("0x%04x%04x%04x%04x", word(108), word(109), word(110), word(111))
+	}
+
+	return id
+}
+
+// ParseNvmeIdentity decodes Identify Controller data structure.
+func ParseNvmeIdentity(data []byte) DeviceIdentity {
+	id := DeviceIdentity{
+		Serial:   strings.TrimSpace(string(data[4:24])),
+		Model:    strings.TrimSpace(string(data[24:64])),
+		Firmware: strings.TrimSpace(string(data[64:72])),
+	}
+	// Total NVM capacity, upper half is ignored
+	if binary.LittleEndian.Uint64(data[288:296]) == 0 {
+		id.Capacity = binary.LittleEndian.Uint64(data[280:288])
+	}
+	return id
+}
+
+// ParseScsiIdentity decodes standard INQUIRY data, unit serial number and
+// device identification VPD pages and READ CAPACITY(16) data.
+// All but INQUIRY data are optional.
+func ParseScsiIdentity(inquiry, serial, identification, capacity []byte) DeviceIdentity {
+	id := DeviceIdentity{}
+	if len(inquiry) >= 36 {
+		id.Model = strings.TrimSpace(string(inquiry[8:16])) + " " +
+			strings.TrimSpace(string(inquiry[16:32]))
+		id.Firmware = strings.TrimSpace(string(inquiry[32:36]))
+	}
+	if len(serial) >= 4 && len(serial) >= 4+int(serial[3]) {
+		id.Serial = strings.TrimSpace(string(serial[4 : 4+int(serial[3])]))
+	}
+	if len(identification) >= 4 {
+		end := 4 + int(binary.BigEndian.Uint16(identification[2:4]))
+		if end > len(identification) {
+			end = len(identification)
+		}
+		for i := 4; i+4 <= end; i += 4 + int(identification[i+3]) {
+			length := int(identification[i+3])
+			if i+4+length > end {
+				break
+			}
+			if identification[i+1]&0x0f == scsi_designator_naa &&
+				(identification[i+1]>>4)&0x03 == scsi_association_logical_unit {
+				id.Wwn = "0x" + hex.EncodeToString(identification[i+4:i+4+length])
+				break
+			}
+		}
+	}
+	if len(capacity) >= 12 {
+		id.Capacity = (binary.BigEndian.Uint64(capacity[0:8]) + 1) *
+			uint64(binary.BigEndian.Uint32(capacity[8:12]))
+	}
+	return id
+}
+
+func readScsiData(fd uintptr, cdb []byte, length int, sysutilProvider SysutilProvider) ([]byte, error) {
+	cmd := ScsiCommand{
+		Cdb:   cdb,
+		Data:  make([]byte, length),
+		Sense: make([]byte, 32),
+	}
+	if err := sysutilProvider.SgIo(fd, &cmd); err != nil {
+		return nil, err
+	}
+	if cmd.Status != scsi_status_good {
+		return nil, scsiStatusError(fmt.Sprintf("SCSI command %#x", cdb[0]), cmd.Status, cmd.Sense)
+	}
+	return cmd.Data, nil
+}
+
+func readScsiIdentity(fd uintptr, sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+	inquiry, err := readScsiData(fd,
+		[]byte{scsi_inquiry, 0, 0, 0, scsi_inquiry_length, 0},
+		scsi_inquiry_length, sysutilProvider)
+	if err != nil {
+		return nil, err
+	}
+	serial, _ := readScsiData(fd,
+		[]byte{scsi_inquiry, 1, scsi_vpd_serial_number, 0, scsi_vpd_length, 0},
+		scsi_vpd_length, sysutilProvider)
+	identification, _ := readScsiData(fd,
+		[]byte{scsi_inquiry, 1, scsi_vpd_identification, 0, scsi_vpd_length, 0},
+		scsi_vpd_length, sysutilProvider)
+	cdb := make([]byte, 16)
+	cdb[0], cdb[1], cdb[13] = scsi_service_action_in, scsi_read_capacity_16, scsi_capacity_length
+	capacity, _ := readScsiData(fd, cdb, scsi_capacity_length, sysutilProvider)
+
+	id := ParseScsiIdentity(inquiry, serial, identification, capacity)
+	return &id, nil
+}
+
+// ReadIdentity_ retrieves identity of drive using IDENTIFY DEVICE for ATA
+// drives, Identify Controller for NVMe controllers and INQUIRY for SCSI ones.
+func ReadIdentity_(device string, sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	if IsNvme(device) {
+		cmd := NvmeAdminCommand{
+			Opcode: nvme_admin_identify,
+			Cdw10:  nvme_identify_controller,
+			Data:   make([]byte, nvme_identify_size),
+		}
+		if err := sysutilProvider.NvmeAdmin(f.Fd(), &cmd); err != nil {
+			return nil, readError(device, "NVMe identify", err)
+		}
+		id := ParseNvmeIdentity(cmd.Data)
+		return &id, nil
+	}
+
+	cmd := AtaCommand{Command: ata_identify_device, Count: 1, Data: make([]byte, 512)}
+	if err := NewAtaTransport(sysutilProvider, device).AtaCommand(f.Fd(), &cmd); err == nil {
+		id := ParseAtaIdentity(cmd.Data)
+		return &id, nil
+	}
+
+	id, err := readScsiIdentity(f.Fd(), sysutilProvider)
+	if err != nil {
+		return nil, readError(device, "identify", err)
+	}
+	return id, nil
+}
+
+// Introduced to make mocking possible. See ReadIdentity_.
+var ReadIdentity = ReadIdentity_
@@ -0,0 +1,241 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func putAtaString(data []byte, s string) {
+	for i := range data {
+		data[i] = ' '
+	}
+	copy(data, s)
+	for i := 0; i+1 < len(data); i += 2 {
+		data[i], data[i+1] = data[i+1], data[i]
+	}
+}
+
+func putWord(data []byte, i int, w uint16) {
+	binary.LittleEndian.PutUint16(data[2*i:], w)
+}
+
+func ataIdentifyFixture() []byte {
+	data := make([]byte, 512)
+	putAtaString(data[20:40], "BTWL1234567890")
+	putAtaString(data[46:54], "G2010140")
+	putAtaString(data[54:94], "INTEL SSDSC2BA200G3")
+	putWord(data, 60, 0xffff)
+	putWord(data, 61, 0x0fff)
+	putWord(data, 83, 1<<10)
+	putWord(data, 87, 0x4100)
+	putWord(data, 100, 0xf1b0)
+	putWord(data, 101, 0x1749)
+	putWord(data, 108, 0x5001)
+	putWord(data, 109, 0x5171)
+	putWord(data, 110, 0x2345)
+	putWord(data, 111, 0x6789)
+	return data
+}
+
+func nvmeIdentifyFixture() []byte {
+	data := make([]byte, nvme_identify_size)
+	copy(data[4:24], "PHLF1234567890      ")
+	copy(data[24:64], "INTEL SSDPE2MD400G4                     ")
+	copy(data[64:72], "8DV10171")
+	binary.LittleEndian.PutUint64(data[280:], 400088457216)
+	return data
+}
+
+var scsiInquiryFixture = append([]byte{0x00, 0x00, 0x06, 0x12, 91, 0, 0, 0x02},
+	[]byte("SEAGATE ST4000NM0023    0004")...)
+
+var scsiSerialFixture = append([]byte{0x00, scsi_vpd_serial_number, 0x00, 0x14},
+	[]byte("Z1Z0ABCD0000C4154XYZ")...)
+
+var scsiIdentificationFixture = []byte{0x00, scsi_vpd_identification, 0x00, 0x18,
+	// target port NAA designator, skipped
+	0x61, 0x93, 0x00, 0x08, 0x50, 0x00, 0xc5, 0x00, 0x11, 0x11, 0x11, 0x11,
+	// logical unit NAA designator
+	0x01, 0x03, 0x00, 0x08, 0x50, 0x00, 0xc5, 0x00, 0x56, 0x78, 0x9a, 0xbc}
+
+var scsiCapacityFixture = []byte{0, 0, 0, 0, 0x1d, 0x1c, 0x5e, 0x2f, 0, 0, 0x02, 0x00}
+
+func TestParseIdentity(t *testing.T) {
+	Convey("Decoding ATA IDENTIFY DEVICE data", t, func() {
+
+		id := ParseAtaIdentity(ataIdentifyFixture())
+
+		So(id, ShouldResemble, DeviceIdentity{
+			Model:    "INTEL SSDSC2BA200G3",
+			Serial:   "BTWL1234567890",
+			Firmware: "G2010140",
+			Wwn:      "0x5001517123456789",
+			Capacity: 390721968 * 512,
+		})
+
+		Convey("Capacity should use 28-bit address without 48-bit support", func() {
+
+			data := ataIdentifyFixture()
+			putWord(data, 83, 0)
+			So(ParseAtaIdentity(data).Capacity, ShouldEqual, 0x0fffffff*512)
+
+		})
+
+		Convey("Capacity should use logical sector size", func() {
+
+			data := ataIdentifyFixture()
+			putWord(data, 106, 0x5000)
+			putWord(data, 117, 2048)
+			So(ParseAtaIdentity(data).Capacity, ShouldEqual, uint64(390721968)*4096)
+
+		})
+
+		Convey("WWN should be omitted when not supported", func() {
+
+			data := ataIdentifyFixture()
+			putWord(data, 87, 0x4000)
+			So(ParseAtaIdentity(data).Wwn, ShouldBeEmpty)
+
+		})
+
+	})
+
+	Convey("Decoding NVMe Identify Controller data", t, func() {
+
+		id := ParseNvmeIdentity(nvmeIdentifyFixture())
+
+		So(id, ShouldResemble, DeviceIdentity{
+			Model:    "INTEL SSDPE2MD400G4",
+			Serial:   "PHLF1234567890",
+			Firmware: "8DV10171",
+			Capacity: 400088457216,
+		})
+
+	})
+
+	Convey("Decoding SCSI identification data", t, func() {
+
+		id := ParseScsiIdentity(scsiInquiryFixture, scsiSerialFixture,
+			scsiIdentificationFixture, scsiCapacityFixture)
+
+		So(id, ShouldResemble, DeviceIdentity{
+			Model:    "SEAGATE ST4000NM0023",
+			Serial:   "Z1Z0ABCD0000C4154XYZ",
+			Firmware: "0004",
+			Wwn:      "0x5000c50056789abc",
+			Capacity: 0x1d1c5e30 * 512,
+		})
+
+		Convey("Optional data may be missing", func() {
+
+			id := ParseScsiIdentity(scsiInquiryFixture, nil, nil, nil)
+			So(id, ShouldResemble, DeviceIdentity{
+				Model:    "SEAGATE ST4000NM0023",
+				Firmware: "0004",
+			})
+
+		})
+
+	})
+
+	Convey("Converting identity to tags", t, func() {
+
+		tags := DeviceIdentity{Model: "M", Serial: "S", Capacity: 1024}.Tags()
+
+		So(tags, ShouldResemble, map[string]string{
+			"model":    "M",
+			"serial":   "S",
+			"capacity": "1024",
+		})
+
+	})
+}
+
+func TestReadIdentity(t *testing.T) {
+	Convey("Identifying ATA device", t, func() {
+
+		provider := &fakeSysutilProvider{IoctlRets: []error{nil},
+			FillBuf: append([]byte{ata_identify_device, 0, 0, 1}, ataIdentifyFixture()...)}
+		id, err := ReadIdentity("sda", provider)
+
+		So(err, ShouldBeNil)
+		So(provider.IoctlArgs[0].buf[0], ShouldEqual, ata_identify_device)
+		So(id.Serial, ShouldEqual, "BTWL1234567890")
+
+	})
+
+	Convey("Identifying NVMe controller", t, func() {
+
+		provider := &fakeNvmeProvider{LogPage: nvmeIdentifyFixture()}
+		id, err := ReadIdentity("nvme0", provider)
+
+		So(err, ShouldBeNil)
+		So(provider.AdminArgs[0].Opcode, ShouldEqual, nvme_admin_identify)
+		So(provider.AdminArgs[0].Cdw10, ShouldEqual, nvme_identify_controller)
+		So(id.Serial, ShouldEqual, "PHLF1234567890")
+
+	})
+
+	Convey("Identifying SCSI device", t, func() {
+
+		provider := &fakeInquiryProvider{
+			fakeSysutilProvider: fakeSysutilProvider{
+				IoctlRets: []error{errors.New("EINVAL")}},
+			Pages: map[byte][]byte{
+				0x00:                    scsiInquiryFixture,
+				scsi_vpd_serial_number:  scsiSerialFixture,
+				scsi_vpd_identification: scsiIdentificationFixture,
+			},
+		}
+		id, err := ReadIdentity("sdc", provider)
+
+		So(err, ShouldBeNil)
+		So(id.Model, ShouldEqual, "SEAGATE ST4000NM0023")
+		So(id.Wwn, ShouldEqual, "0x5000c50056789abc")
+		So(id.Capacity, ShouldEqual, 0)
+
+	})
+}
+
+// Answers INQUIRY commands only, ATA PASS-THROUGH is rejected.
+type fakeInquiryProvider struct {
+	fakeSysutilProvider
+
+	Pages map[byte][]byte
+}
+
+func (s *fakeInquiryProvider) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	page, ok := s.Pages[cmd.Cdb[2]]
+	if cmd.Cdb[0] != scsi_inquiry || !ok {
+		cmd.Status = scsi_status_check_condition
+		cmd.Sense = cmd.Sense[:copy(cmd.Sense, []byte{0x70, 0, 0x05})]
+		return nil
+	}
+	copy(cmd.Data, page)
+	return nil
+}
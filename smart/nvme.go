@@ -0,0 +1,206 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+const (
+	nvme_ioctl_admin_cmd    = 0xc0484e41
+	nvme_admin_get_log_page = 0x02
+	nvme_log_smart          = 0x02
+	nvme_nsid_all           = 0xffffffff
+	nvme_log_size           = 512
+
+	// Bits of critical warning field which mean that device is failing
+	nvme_critical_warning_mask = 0x1f
+	kelvin_offset              = 273
+)
+
+// Matches block devices of NVMe namespaces, first group is name of controller.
+var nvmeNamespaceRe = regexp.MustCompile(`^(nvme[0-9]+)n[0-9]+$`)
+
+// NvmeAdminCommand describes NVMe admin command passed through to device.
+// Data is transferred from device, Result holds completion dword 0.
+type NvmeAdminCommand struct {
+	Opcode byte
+	Nsid   uint32
+	Cdw10  uint32
+	Cdw11  uint32
+	Data   []byte
+	Result uint32
+}
+
+// Data format of SMART / Health Information log page.
+type NvmeSmartLog struct {
+	CriticalWarning         byte
+	Temperature             uint16
+	AvailableSpare          byte
+	AvailableSpareThreshold byte
+	PercentageUsed          byte
+	Reserved1               [26]byte
+	DataUnitsRead           [16]byte
+	DataUnitsWritten        [16]byte
+	HostReadCommands        [16]byte
+	HostWriteCommands       [16]byte
+	ControllerBusyTime      [16]byte
+	PowerCycles             [16]byte
+	PowerOnHours            [16]byte
+	UnsafeShutdowns         [16]byte
+	MediaErrors             [16]byte
+	ErrorLogEntries         [16]byte
+	WarningTemperatureTime  uint32
+	CriticalTemperatureTime uint32
+	TemperatureSensors      [8]uint16
+	Reserved2               [296]byte
+}
+
+// Keys of values available in SMART / Health Information log.
+var nvmeKeys = []string{
+	"nvme/criticalwarning",
+	"nvme/temperature",
+	"nvme/availablespare",
+	"nvme/availablespare/threshold",
+	"nvme/percentageused",
+	"nvme/dataunits/read",
+	"nvme/dataunits/written",
+	"nvme/powercycles",
+	"nvme/poweronhours",
+	"nvme/unsafeshutdowns",
+	"nvme/mediaerrors",
+	"nvme/errorlogentries",
+}
+
+// IsNvme tells whether device name refers to NVMe controller.
+func IsNvme(device string) bool {
+	return strings.HasPrefix(device, "nvme")
+}
+
+// ReadNvmeSmartLog_ retrieves SMART / Health Information log page
+// from NVMe controller. It returns data casted to appropriate Go structure.
+func ReadNvmeSmartLog_(device string, sysutilProvider SysutilProvider) (*NvmeSmartLog, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	cmd := NvmeAdminCommand{
+		Opcode: nvme_admin_get_log_page,
+		Nsid:   nvme_nsid_all,
+		Cdw10:  nvme_log_smart | (nvme_log_size/4-1)<<16,
+		Data:   make([]byte, nvme_log_size),
+	}
+	if err := sysutilProvider.NvmeAdmin(f.Fd(), &cmd); err != nil {
+		return nil, readError(device, "NVMe SMART log reading", err)
+	}
+
+	log := NvmeSmartLog{}
+	log_data := bytes.NewBuffer(cmd.Data)
+	binary.Read(log_data, binary.LittleEndian, &log)
+
+	return &log, nil
+}
+
+// Introduced to make mocking possible. See ReadNvmeSmartLog_.
+var ReadNvmeSmartLog = ReadNvmeSmartLog_
+
+// Converts 128 bit little endian counter, saturating on overflow.
+func nvmeCounter(data [16]byte) uint64 {
+	if binary.LittleEndian.Uint64(data[8:]) != 0 {
+		return math.MaxUint64
+	}
+	return binary.LittleEndian.Uint64(data[:8])
+}
+
+// Passed tells whether controller reports no critical warnings.
+func (l NvmeSmartLog) Passed() bool {
+	return l.CriticalWarning&nvme_critical_warning_mask == 0
+}
+
+// GetAttributes transforms SMART / Health Information log to map containing
+// its values. Keys are listed in nvmeKeys.
+func (l NvmeSmartLog) GetAttributes() map[string]interface{} {
+	return map[string]interface{}{
+		"nvme/criticalwarning":          l.CriticalWarning,
+		"nvme/temperature":              int64(l.Temperature) - kelvin_offset,
+		"nvme/availablespare":           l.AvailableSpare,
+		"nvme/availablespare/threshold": l.AvailableSpareThreshold,
+		"nvme/percentageused":           l.PercentageUsed,
+		"nvme/dataunits/read":           nvmeCounter(l.DataUnitsRead),
+		"nvme/dataunits/written":        nvmeCounter(l.DataUnitsWritten),
+		"nvme/powercycles":              nvmeCounter(l.PowerCycles),
+		"nvme/poweronhours":             nvmeCounter(l.PowerOnHours),
+		"nvme/unsafeshutdowns":          nvmeCounter(l.UnsafeShutdowns),
+		"nvme/mediaerrors":              nvmeCounter(l.MediaErrors),
+		"nvme/errorlogentries":          nvmeCounter(l.ErrorLogEntries),
+	}
+}
+
+// Layout of struct nvme_passthru_cmd from linux/nvme_ioctl.h.
+type nvmePassthruCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+func (s *sysutilProviderLinux) NvmeAdmin(fd uintptr, cmd *NvmeAdminCommand) error {
+	c := nvmePassthruCmd{
+		opcode: cmd.Opcode,
+		nsid:   cmd.Nsid,
+		cdw10:  cmd.Cdw10,
+		cdw11:  cmd.Cdw11,
+	}
+	if len(cmd.Data) > 0 {
+		c.addr = uint64(uintptr(unsafe.Pointer(&cmd.Data[0])))
+		c.dataLen = uint32(len(cmd.Data))
+	}
+
+	buf := (*[unsafe.Sizeof(c)]byte)(unsafe.Pointer(&c))[:]
+	err := s.Ioctl(fd, nvme_ioctl_admin_cmd, buf)
+	runtime.KeepAlive(cmd.Data)
+	cmd.Result = c.result
+
+	return err
+}
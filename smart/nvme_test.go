@@ -0,0 +1,147 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeNvmeProvider struct {
+	fakeSysutilProvider
+
+	AdminArgs []NvmeAdminCommand
+	AdminRet  error
+	LogPage   []byte
+}
+
+func (s *fakeNvmeProvider) NvmeAdmin(fd uintptr, cmd *NvmeAdminCommand) error {
+	s.AdminArgs = append(s.AdminArgs, *cmd)
+	copy(cmd.Data, s.LogPage)
+
+	return s.AdminRet
+}
+
+func nvmeSmartLogFixture() []byte {
+	page := make([]byte, nvme_log_size)
+	page[0] = 0x04                // critical warning: reliability degraded
+	page[1], page[2] = 0x3a, 0x01 // 314 K
+	page[3], page[4], page[5] = 98, 10, 3
+	page[32], page[34] = 0x01, 0x02   // data units read
+	page[48] = 0xff                   // data units written
+	page[112] = 12                    // power cycles
+	page[128], page[129] = 0x10, 0x27 // power on hours
+	page[144] = 5                     // unsafe shutdowns
+	page[160] = 1                     // media errors
+	page[176] = 42                    // error log entries
+	return page
+}
+
+func TestNvmeSmartLog(t *testing.T) {
+	Convey("Reading SMART log from NVMe controller", t, func() {
+
+		provider := &fakeNvmeProvider{LogPage: nvmeSmartLogFixture()}
+		log, err := ReadNvmeSmartLog("nvme0", provider)
+
+		Convey("Should open controller device", func() {
+
+			So(provider.OpenDeviceArg, ShouldResemble, []string{"nvme0"})
+
+		})
+
+		Convey("Should ask for SMART / Health Information log page", func() {
+
+			So(len(provider.AdminArgs), ShouldEqual, 1)
+			So(provider.AdminArgs[0].Opcode, ShouldEqual, nvme_admin_get_log_page)
+			So(provider.AdminArgs[0].Nsid, ShouldEqual, uint32(nvme_nsid_all))
+			So(provider.AdminArgs[0].Cdw10, ShouldEqual, 0x007f0002)
+			So(len(provider.AdminArgs[0].Data), ShouldEqual, 512)
+
+		})
+
+		Convey("Should decode log page", func() {
+
+			So(err, ShouldBeNil)
+			attrs := log.GetAttributes()
+			So(attrs["nvme/criticalwarning"], ShouldEqual, 4)
+			So(attrs["nvme/temperature"], ShouldEqual, 41)
+			So(attrs["nvme/availablespare"], ShouldEqual, 98)
+			So(attrs["nvme/availablespare/threshold"], ShouldEqual, 10)
+			So(attrs["nvme/percentageused"], ShouldEqual, 3)
+			So(attrs["nvme/dataunits/read"], ShouldEqual, 0x020001)
+			So(attrs["nvme/dataunits/written"], ShouldEqual, 0xff)
+			So(attrs["nvme/powercycles"], ShouldEqual, 12)
+			So(attrs["nvme/poweronhours"], ShouldEqual, 10000)
+			So(attrs["nvme/unsafeshutdowns"], ShouldEqual, 5)
+			So(attrs["nvme/mediaerrors"], ShouldEqual, 1)
+			So(attrs["nvme/errorlogentries"], ShouldEqual, 42)
+
+		})
+
+		Convey("Should report controller as failing", func() {
+
+			So(log.Passed(), ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("When controller rejects command", t, func() {
+
+		provider := &fakeNvmeProvider{AdminRet: errors.New("Something")}
+		_, err := ReadNvmeSmartLog("nvme0", provider)
+
+		Convey("Error should be about reading", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "read")
+
+		})
+
+	})
+
+	Convey("When counter exceeds 64 bits", t, func() {
+
+		counter := [16]byte{}
+		counter[8] = 1
+
+		Convey("Value should saturate", func() {
+
+			So(nvmeCounter(counter), ShouldEqual, uint64(1<<64-1))
+
+		})
+
+	})
+
+	Convey("Keys and output of decoding are consistent", t, func() {
+
+		attrs := NvmeSmartLog{}.GetAttributes()
+		So(len(attrs), ShouldEqual, len(nvmeKeys))
+		for _, key := range nvmeKeys {
+			So(attrs, ShouldContainKey, key)
+		}
+
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -44,6 +45,13 @@ const (
 	nsClass  = "disk"
 	nsType   = "smart"
 	devname  = "device"
+
+	// Supported values of device_naming option
+	namingKernel = "kernel"
+	namingSerial = "serial"
+	namingWwn    = "wwn"
+	namingById   = "by-id"
+	namingByPath = "by-path"
 )
 
 var (
@@ -51,6 +59,8 @@ var (
 	procPath = "/proc"
 	//devPath source of data for metrics
 	devPath = "/dev"
+	//powerCheckMaxSkips limit of collections in a row disk is not read
+	powerCheckMaxSkips = 10
 
 	namespace_prefix = []string{nsVendor, nsClass, nsType}
 
@@ -75,7 +85,13 @@ func NewSmartCollector() *SmartCollector {
 		logger:           logger,
 		initializedMutex: imutex,
 		proc_path:        procPath,
+		sys_path:         sysfsPath(procPath),
 		dev_path:         devPath,
+		device_naming:    namingKernel,
+		identities:       map[string]*DeviceIdentity{},
+		enable_smart:     true,
+
+		power_check_max_skips: powerCheckMaxSkips,
 	}
 }
 
@@ -116,8 +132,86 @@ func (sc *SmartCollector) setProcDevPath(cfg interface{}) error {
 		}
 		sc.dev_path = devPath.(string)
 	}
+	// Sysfs is expected next to procfs unless given explicitly
+	sc.sys_path = sysfsPath(sc.proc_path)
+	sysPath, err := config.GetConfigItem(cfg, "sys_path")
+	if err == nil && len(sysPath.(string)) > 0 {
+		sysPathStats, err := os.Stat(sysPath.(string))
+		if err != nil {
+			return err
+		}
+		if !sysPathStats.IsDir() {
+			return errors.New(fmt.Sprintf("%s is not a directory", sysPath.(string)))
+		}
+		sc.sys_path = sysPath.(string)
+	}
+	dbPath, err := config.GetConfigItem(cfg, "attribute_db")
+	if err == nil && len(dbPath.(string)) > 0 {
+		db, err := LoadAttributeDb(dbPath.(string))
+		if err != nil {
+			return err
+		}
+		sc.attribute_db = db
+	}
+	naming, err := config.GetConfigItem(cfg, "device_naming")
+	if err == nil && len(naming.(string)) > 0 {
+		switch naming.(string) {
+		case namingKernel, namingSerial, namingWwn, namingById, namingByPath:
+			sc.device_naming = naming.(string)
+		default:
+			return errors.New(fmt.Sprintf("%s is not a valid device naming", naming.(string)))
+		}
+	}
+	powerCheck, err := config.GetConfigItem(cfg, "power_check")
+	if err == nil && len(powerCheck.(string)) > 0 {
+		mode, ok := powerCheckPolicies[powerCheck.(string)]
+		if !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid power check policy", powerCheck.(string)))
+		}
+		sc.power_check = mode
+	}
+	maxSkips, err := config.GetConfigItem(cfg, "power_check_max_skips")
+	if err == nil {
+		sc.power_check_max_skips = maxSkips.(int)
+	}
+	schedule, err := config.GetConfigItem(cfg, "selftest_schedule")
+	if err == nil && len(schedule.(string)) > 0 {
+		scheduler, err := ParseSelfTestSchedules(schedule.(string))
+		if err != nil {
+			return err
+		}
+		sc.selftest_scheduler = scheduler
+	}
+	include, err := config.GetConfigItem(cfg, "include_devices")
+	if err != nil {
+		include = ""
+	}
+	exclude, err := config.GetConfigItem(cfg, "exclude_devices")
+	if err != nil {
+		exclude = ""
+	}
+	filter, err := ParseDeviceFilter(include.(string), exclude.(string))
+	if err != nil {
+		return err
+	}
+	sc.device_filter = filter
+	readOnly, err := config.GetConfigItem(cfg, "read_only")
+	if err == nil {
+		sc.read_only = readOnly.(bool)
+	}
+	// Enabling SMART requires write access, so it is skipped in read-only
+	// mode unless requested explicitly
+	sc.enable_smart = !sc.read_only
+	enableSmart, err := config.GetConfigItem(cfg, "enable_smart")
+	if err == nil {
+		sc.enable_smart = enableSmart.(bool)
+	}
 	if sysUtilProvider == nil {
-		sysUtilProvider = NewSysutilProvider(sc.proc_path, sc.dev_path)
+		if sc.read_only {
+			sysUtilProvider = NewReadOnlySysutilProvider(sc.proc_path, sc.dev_path, sc.sys_path)
+		} else {
+			sysUtilProvider = NewSysutilProvider(sc.proc_path, sc.dev_path, sc.sys_path)
+		}
 	}
 	sc.initialized = true
 	return nil
@@ -129,40 +223,516 @@ type SmartCollector struct {
 	logger           *log.Logger
 	proc_path        string
 	dev_path         string
+	sys_path         string
+	device_naming    string
+	identities       map[string]*DeviceIdentity
+	names            map[string]string
+	device_filter    *DeviceFilter
+	statuses         map[string]*deviceStatus
+	attribute_db     *AttributeDb
+	read_only        bool
+	enable_smart     bool
+	// Least power consuming mode in which disks are not read,
+	// PowerModeUnknown if power mode is not checked
+	power_check           PowerMode
+	power_check_max_skips int
+	power_skips           map[string]int
+	power_checked         map[string]bool
+	selftest_scheduler    *SelfTestScheduler
+	// Error log counts from previous collection, by disk
+	error_counts map[string]uint16
+}
+
+// runScheduledSelfTest starts self-test on disk if one is due, unless
+// another one is in progress.
+func (sc *SmartCollector) runScheduledSelfTest(disk string, values *SmartValues) {
+	now := time.Now()
+	test, due := sc.selftest_scheduler.Due(disk, now)
+	if !due {
+		return
+	}
+	if values.SelfTestInProgress() {
+		sc.logger.Warning(fmt.Sprintf("Not starting scheduled self-test on %s disk, previous one is in progress", disk))
+		return
+	}
+	if err := ExecuteSelfTest(disk, test, sysUtilProvider); err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error starting scheduled self-test on %s disk: %v", disk, err))
+		return
+	}
+	sc.selftest_scheduler.Started(disk, now)
+}
+
+// Values of power_check option, disks in given or less power consuming
+// mode are not read.
+var powerCheckPolicies = map[string]PowerMode{
+	"never":   PowerModeUnknown,
+	"idle":    PowerModeIdle,
+	"standby": PowerModeStandby,
+	"sleep":   PowerModeSleep,
+}
+
+// checkPowerMode tells power mode of disk and whether reading it should be
+// skipped to let it stay in low power mode. Disks are skipped at most
+// power_check_max_skips times in a row, if it is set.
+// Disk which never responded to power mode check is assumed to not support
+// it and is read, while failure of disk which responded before, e.g. pulled
+// one, is reported as error.
+func (sc *SmartCollector) checkPowerMode(disk string) (PowerMode, bool, error) {
+	if sc.power_skips == nil {
+		sc.power_skips = map[string]int{}
+		sc.power_checked = map[string]bool{}
+	}
+	mode, err := ReadPowerMode(disk, sysUtilProvider)
+	if err != nil {
+		sc.power_skips[disk] = 0
+		if sc.power_checked[disk] {
+			return PowerModeUnknown, false, err
+		}
+		return PowerModeUnknown, false, nil
+	}
+	sc.power_checked[disk] = true
+	if mode == PowerModeUnknown || mode < sc.power_check ||
+		(sc.power_check_max_skips > 0 && sc.power_skips[disk] >= sc.power_check_max_skips) {
+		sc.power_skips[disk] = 0
+		return mode, false, nil
+	}
+	sc.power_skips[disk]++
+	return mode, true, nil
+}
+
+// skipped tells whether reading disk was skipped in the last collection
+// by power mode check.
+func (sc *SmartCollector) skipped(disk string) bool {
+	return sc.power_skips[disk] > 0
+}
+
+// identity returns identity of disk, which is read once and cached until
+// disk fails to be read. Disks which cannot be identified have empty identity,
+// as well as disks skipped by power mode check which were not identified yet.
+func (sc *SmartCollector) identity(disk string) *DeviceIdentity {
+	if sc.identities == nil {
+		sc.identities = map[string]*DeviceIdentity{}
+	}
+	id, ok := sc.identities[disk]
+	if !ok && sc.skipped(disk) {
+		// Identifying disk would spin it up
+		return &DeviceIdentity{}
+	}
+	if !ok {
+		var err error
+		id, err = ReadIdentity(disk, sysUtilProvider)
+		if err != nil {
+			sc.logger.Warning(fmt.Sprintf("Error identifying %s disk: %v", disk, err))
+			id = &DeviceIdentity{}
+		}
+		sc.identities[disk] = id
+	}
+	return id
+}
+
+// collectedIdentity returns identity of disk for metrics of current
+// collection. Disks which failed to be read are not identified again, so
+// cached or empty identity is returned for them.
+func (sc *SmartCollector) collectedIdentity(disk string) *DeviceIdentity {
+	if status, ok := sc.statuses[disk]; ok && status.err != nil {
+		if id, ok := sc.identities[disk]; ok {
+			return id
+		}
+		return &DeviceIdentity{}
+	}
+	return sc.identity(disk)
+}
+
+// deviceName returns name of disk used in namespace, according to
+// configured device naming. Kernel name is used when disk has no
+// serial number, WWN or persistent link. Name is resolved once per
+// collection.
+func (sc *SmartCollector) deviceName(disk string) string {
+	if sc.names == nil {
+		sc.names = map[string]string{}
+	}
+	if name, ok := sc.names[disk]; ok {
+		return name
+	}
+	var name string
+	switch sc.device_naming {
+	case namingSerial:
+		name = sc.collectedIdentity(disk).Serial
+	case namingWwn:
+		name = sc.collectedIdentity(disk).Wwn
+		if name == "" {
+			name = wwnFromLinks(ListDeviceLinks(sc.dev_path, linksById, disk))
+		}
+	case namingById:
+		name = preferredIdLink(ListDeviceLinks(sc.dev_path, linksById, disk))
+	case namingByPath:
+		if links := ListDeviceLinks(sc.dev_path, linksByPath, disk); len(links) > 0 {
+			name = links[0]
+		}
+	default:
+		name = disk
+	}
+	if name == "" {
+		sc.logger.Warning(fmt.Sprintf("No %s name of %s disk, using kernel name", sc.device_naming, disk))
+		name = disk
+	}
+	sc.names[disk] = name
+	return name
+}
+
+// kernelName finds kernel name of disk given by name used in namespace.
+// Kernel names, names of links in by-id and by-path directories and WWNs
+// are accepted with any device naming. Serial numbers and WWNs are looked
+// up in names and identities already known, then serial numbers in sysfs
+// and by-id links, so disks are not opened.
+func (sc *SmartCollector) kernelName(name string) string {
+	if disk, ok := ResolveDeviceLink(sc.dev_path, name); ok {
+		return disk
+	}
+	if disk, ok := ResolveDeviceLink(sc.dev_path, "wwn-"+name); ok {
+		return disk
+	}
+	if sc.device_naming != namingSerial && sc.device_naming != namingWwn {
+		return name
+	}
+	for disk, n := range sc.names {
+		if n == name {
+			return disk
+		}
+	}
+	for disk, id := range sc.identities {
+		if (sc.device_naming == namingSerial && id.Serial == name) ||
+			(sc.device_naming == namingWwn && id.Wwn == name) {
+			return disk
+		}
+	}
+	if sc.device_naming != namingSerial {
+		return name
+	}
+	devices, err := sysUtilProvider.ListDevices()
+	if err != nil {
+		return name
+	}
+	for _, dev := range devices {
+		info := ReadDeviceInfo(sc.sys_path, sc.dev_path, dev)
+		if info.Serial == name {
+			return dev
+		}
+		// By-id links of ATA and SCSI disks end with serial number
+		for _, link := range info.ById {
+			if strings.HasSuffix(link, "_"+name) {
+				return dev
+			}
+		}
+	}
+	return name
+}
+
+// allowed returns true if disk is selected by configured device filter.
+// Disk is not opened, though its identity is used if already known.
+func (sc *SmartCollector) allowed(disk string) bool {
+	if sc.device_filter.Empty() {
+		return true
+	}
+	info := ReadDeviceInfo(sc.sys_path, sc.dev_path, disk)
+	if id, ok := sc.identities[disk]; ok {
+		if info.Model == "" {
+			info.Model = id.Model
+		}
+		if info.Serial == "" {
+			info.Serial = id.Serial
+		}
+	}
+	return sc.device_filter.Allows(info)
 }
 
 type smartResults map[string]interface{}
 
-// DiskMetrics returns metrics from smart on given disk
+// Keys of metrics describing collection of data from device
+var collectorKeys = []string{"collector/up", "collector/error_code", "collector/last_success",
+	"collector/checksum_errors", "collector/skipped"}
+
+// deviceStatus describes results of collections from device.
+type deviceStatus struct {
+	err             error
+	last_success    time.Time
+	checksum_errors uint64
+}
+
+// updateStatus records result of reading disk at given time and returns
+// collector metrics describing it. Disk skipped by power mode check was
+// not read, so it does not count as success. Time of last success is zero
+// if disk has never been read successfully.
+func (sc *SmartCollector) updateStatus(disk string, t time.Time, skipped bool, err error) smartResults {
+	if sc.statuses == nil {
+		sc.statuses = map[string]*deviceStatus{}
+	}
+	status, ok := sc.statuses[disk]
+	if !ok {
+		status = &deviceStatus{}
+		sc.statuses[disk] = status
+	}
+	status.err = err
+	if err == nil && !skipped {
+		status.last_success = t
+	}
+	if ErrorCodeOf(err) == ErrorChecksum {
+		status.checksum_errors++
+	}
+	var last_success int64
+	if !status.last_success.IsZero() {
+		last_success = status.last_success.Unix()
+	}
+	return smartResults{
+		"collector/up":              err == nil,
+		"collector/error_code":      int(ErrorCodeOf(err)),
+		"collector/last_success":    last_success,
+		"collector/checksum_errors": status.checksum_errors,
+		"collector/skipped":         skipped,
+	}
+}
+
+// readDisk gathers all values available from smart on given disk.
+// Only failure of reading smart data is fatal, other failures are logged.
+func (sc *SmartCollector) readDisk(disk string) (smartResults, error) {
+	if IsNvme(disk) {
+		return sc.readNvmeDisk(disk)
+	}
+	if sc.power_check == PowerModeUnknown {
+		return sc.readAtaDisk(disk)
+	}
+
+	mode, skip, err := sc.checkPowerMode(disk)
+	if err != nil {
+		return nil, err
+	}
+	if skip {
+		return smartResults{powerModeKey: mode.String()}, nil
+	}
+	results, err := sc.readAtaDisk(disk)
+	if err != nil {
+		return nil, err
+	}
+	results[powerModeKey] = mode.String()
+
+	return results, nil
+}
+
+// readAtaDisk gathers values available from ATA SMART on given disk,
+// or from log pages if it is SCSI device.
+func (sc *SmartCollector) readAtaDisk(disk string) (smartResults, error) {
+	readSmart := ReadSmartValues
+	if sc.enable_smart {
+		readSmart = ReadSmartData
+	}
+	values, err := readSmart(disk, sysUtilProvider)
+	if err != nil {
+		// Devices without ATA SMART, like SAS drives, may provide log pages.
+		// Other failures, like corrupt data, are reported as they are.
+		if ErrorCodeOf(err) != ErrorUnsupported {
+			return nil, err
+		}
+		results, scsi_err := sc.readScsiDisk(disk)
+		if scsi_err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	defs := AttributeMap
+	if sc.attribute_db != nil {
+		id := sc.identity(disk)
+		defs = sc.attribute_db.Lookup(id.Model, id.Firmware)
+	}
+	results := smartResults(values.GetAttributesFor(defs))
+	for k, v := range values.GetSelfTestProgress() {
+		results[k] = v
+	}
+	for k, v := range values.GetCapabilities() {
+		results[k] = v
+	}
+	if sc.selftest_scheduler != nil {
+		sc.runScheduledSelfTest(disk, values)
+		for k, v := range sc.selftest_scheduler.GetAttributes(disk) {
+			results[k] = v
+		}
+	}
+	for k, v := range values.GetAttributesById() {
+		results[k] = v
+	}
+
+	thresholds, err := ReadSmartThresholds(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading SMART thresholds on %s disk: %v", disk, err))
+	} else {
+		for k, v := range thresholds.GetAttributesFor(*values, defs) {
+			results[k] = v
+		}
+		results["health/failingattributes"] = thresholds.CountFailing(*values)
+	}
+
+	selftests, err := ReadSelfTestLog(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading SMART self-test log on %s disk: %v", disk, err))
+	} else {
+		for k, v := range selftests.GetAttributes() {
+			results[k] = v
+		}
+	}
+
+	errorlog, err := ReadErrorLog(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading SMART error log on %s disk: %v", disk, err))
+	} else {
+		for k, v := range errorlog.GetAttributes() {
+			results[k] = v
+		}
+		if sc.error_counts == nil {
+			sc.error_counts = map[string]uint16{}
+		}
+		// Error count saturates instead of wrapping around, so lower count
+		// means that log was reset or disk was replaced
+		if previous, ok := sc.error_counts[disk]; ok && errorlog.Count >= previous {
+			results[errorLogDeltaKey] = uint64(errorlog.Count - previous)
+		}
+		sc.error_counts[disk] = errorlog.Count
+	}
+
+	devstats, err := ReadDeviceStatistics(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading device statistics on %s disk: %v", disk, err))
+	} else {
+		for k, v := range devstats.GetAttributes() {
+			results[k] = v
+		}
+	}
+
+	sct, err := ReadSctTemperatures(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading SCT status on %s disk: %v", disk, err))
+	} else {
+		for k, v := range sct.GetAttributes() {
+			results[k] = v
+		}
+	}
+
+	passed, err := ReadSmartStatus(disk, sysUtilProvider)
+	if err != nil {
+		sc.logger.Warning(fmt.Sprintf("Error reading SMART status on %s disk: %v", disk, err))
+	} else {
+		results["health/passed"] = passed
+	}
+
+	return results, nil
+}
+
+// readNvmeDisk gathers values available in SMART / Health Information log
+// of given NVMe controller.
+func (sc *SmartCollector) readNvmeDisk(disk string) (smartResults, error) {
+	log, err := ReadNvmeSmartLog(disk, sysUtilProvider)
+	if err != nil {
+		return nil, err
+	}
+	results := smartResults(log.GetAttributes())
+	results["health/passed"] = log.Passed()
+
+	return results, nil
+}
+
+// readScsiDisk gathers values available in log pages of given SCSI device.
+func (sc *SmartCollector) readScsiDisk(disk string) (smartResults, error) {
+	logs, err := ReadScsiLogs(disk, sysUtilProvider)
+	if err != nil {
+		return nil, err
+	}
+	results := smartResults(logs.GetAttributes())
+	if passed, ok := logs.Passed(); ok {
+		results["health/passed"] = passed
+	}
+
+	return results, nil
+}
+
+// matchAttributes returns sorted paths of values in results matching given
+// attribute path, in which any element can be "*" (dynamic element).
+func matchAttributes(results smartResults, attribute_path string) []string {
+	if !strings.Contains(attribute_path, "*") {
+		if _, ok := results[attribute_path]; ok {
+			return []string{attribute_path}
+		}
+		return nil
+	}
+	pattern := strings.Split(attribute_path, "/")
+	paths := []string{}
+	for path := range results {
+		elts := strings.Split(path, "/")
+		if len(elts) != len(pattern) {
+			continue
+		}
+		matches := true
+		for i, elt := range pattern {
+			if elt != "*" && elt != elts[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// DiskMetrics returns metrics from smart on given disk, more of them if
+// attribute path has dynamic elements.
 func (sc *SmartCollector) DiskMetrics(ns []core.NamespaceElement,
 	t time.Time, disk string, attribute_path string,
-	buffered_results map[string]smartResults) (plugin.MetricType, error) {
-	var result plugin.MetricType
+	buffered_results map[string]smartResults) ([]plugin.MetricType, error) {
 	buffered, ok := buffered_results[disk]
 	if !ok {
-		values, err := ReadSmartData(disk, sysUtilProvider)
+		var err error
+		buffered, err = sc.readDisk(disk)
 		if err != nil {
-			return result, err
+			buffered = smartResults{}
+		} else {
+			for k, v := range DeriveMetrics(buffered, sc.identity(disk).Model) {
+				buffered[k] = v
+			}
+		}
+		for k, v := range sc.updateStatus(disk, t, err == nil && sc.skipped(disk), err) {
+			buffered[k] = v
 		}
-		buffered = values.GetAttributes()
 		buffered_results[disk] = buffered
 	}
-	attribute, ok := buffered[attribute_path]
-	if !ok {
-		return result, fmt.Errorf("Unknown attribute %s", attribute_path)
+	paths := matchAttributes(buffered, attribute_path)
+	if len(paths) == 0 {
+		if err := sc.statuses[disk].err; err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Unknown attribute %s", attribute_path)
 	}
 
-	ns1 := make([]core.NamespaceElement, len(ns))
-	copy(ns1, ns)
-	ns1[3].Value = disk
-	result = plugin.MetricType{
-		Namespace_: ns1,
-		Timestamp_: t,
-		Version_:   version,
-		Data_:      attribute,
+	results := []plugin.MetricType{}
+	for _, path := range paths {
+		ns1 := make([]core.NamespaceElement, len(ns))
+		copy(ns1, ns)
+		ns1[3].Value = sc.deviceName(disk)
+		if path != attribute_path {
+			for i, elt := range strings.Split(path, "/") {
+				ns1[len(namespace_prefix)+1+i].Value = elt
+			}
+		}
+		results = append(results, plugin.MetricType{
+			Namespace_: ns1,
+			Timestamp_: t,
+			Version_:   version,
+			Data_:      buffered[path],
+			Tags_:      sc.collectedIdentity(disk).Tags(),
+			Unit_:      derivedUnits[path],
+		})
 	}
 
-	return result, nil
+	return results, nil
 }
 
 // CollectMetrics returns metrics from smart
@@ -173,6 +743,10 @@ func (sc *SmartCollector) CollectMetrics(mts []plugin.MetricType) ([]plugin.Metr
 
 	buffered_results := map[string]smartResults{}
 	results := []plugin.MetricType{}
+	// Names are resolved again in each collection, as links may change
+	sc.names = map[string]string{}
+	// Devices selected by filter, listed once per collection
+	var devices []string
 
 	t := time.Now()
 	for _, mt := range mts {
@@ -180,28 +754,42 @@ func (sc *SmartCollector) CollectMetrics(mts []plugin.MetricType) ([]plugin.Metr
 		disk, attribute_path := parseName(ns.Strings())
 		if disk == "*" {
 			// All system disks requested
-			devices, err := sysUtilProvider.ListDevices()
-			if err != nil {
-				return nil, err
+			if devices == nil {
+				all, err := sysUtilProvider.ListDevices()
+				if err != nil {
+					return nil, err
+				}
+				devices = []string{}
+				for _, dev := range all {
+					if sc.allowed(dev) {
+						devices = append(devices, dev)
+					}
+				}
 			}
 			for _, dev := range devices {
-				result, err := sc.DiskMetrics(ns, t, dev, attribute_path, buffered_results)
+				metrics, err := sc.DiskMetrics(ns, t, dev, attribute_path, buffered_results)
 				if err != nil {
 					sc.logger.Warning(fmt.Sprintf("Error collecting SMART %s data on %s disk: %v", attribute_path, dev, err))
 				} else {
-					results = append(results, result)
+					results = append(results, metrics...)
 				}
 			}
 		} else {
 			// Single disk requested
-			result, err := sc.DiskMetrics(ns, t, disk, attribute_path, buffered_results)
+			metrics, err := sc.DiskMetrics(ns, t, sc.kernelName(disk), attribute_path, buffered_results)
 			if err != nil {
 				sc.logger.Warning(fmt.Sprintf("Error collecting SMART %s data on %s disk: %v", attribute_path, disk, err))
 			} else {
-				results = append(results, result)
+				results = append(results, metrics...)
 			}
 		}
 	}
+	for disk := range buffered_results {
+		if sc.statuses[disk].err != nil {
+			// Disk could be replaced, so it has to be identified again
+			delete(sc.identities, disk)
+		}
+	}
 	if len(results) == 0 {
 		return nil, errors.New("No metrics found")
 
@@ -213,21 +801,43 @@ func (sc *SmartCollector) CollectMetrics(mts []plugin.MetricType) ([]plugin.Metr
 // GetMetricTypes returns the metric types exposed by smart
 func (sc *SmartCollector) GetMetricTypes(cfg plugin.ConfigType) ([]plugin.MetricType, error) {
 	smart_metrics := ListAllKeys()
+	dbPath, err := config.GetConfigItem(cfg, "attribute_db")
+	if err == nil && len(dbPath.(string)) > 0 {
+		db, err := LoadAttributeDb(dbPath.(string))
+		if err != nil {
+			return nil, err
+		}
+		known := map[string]bool{}
+		for _, metric := range smart_metrics {
+			known[metric] = true
+		}
+		for _, metric := range db.ListKeys() {
+			if !known[metric] {
+				known[metric] = true
+				smart_metrics = append(smart_metrics, metric)
+			}
+		}
+	}
 	mts := []plugin.MetricType{}
 	for _, metric := range smart_metrics {
 		ns := core.NewNamespace(namespace_prefix...).AddDynamicElement(devname, "SMART device")
 		for _, elt := range strings.Split(metric, "/") {
-			ns = ns.AddStaticElement(elt)
+			if name, ok := parseDynamicElement(elt); ok {
+				ns = ns.AddDynamicElement(name, dynamicElements[name])
+			} else {
+				ns = ns.AddStaticElement(elt)
+			}
 		}
 		mts = append(mts, plugin.MetricType{
 			Namespace_:   ns,
 			Description_: "dynamic SMART metric: " + metric,
+			Unit_:        derivedUnits[metric],
 		})
 	}
 	return mts, nil
 }
 
-//GetConfigPolicy returns a ConfigPolicy
+// GetConfigPolicy returns a ConfigPolicy
 func (p *SmartCollector) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
 	cp := cpolicy.New()
 	rule, _ := cpolicy.NewStringRule("proc_path", false, "/proc")
@@ -236,5 +846,25 @@ func (p *SmartCollector) GetConfigPolicy() (*cpolicy.ConfigPolicy, error) {
 	cp.Add([]string{nsVendor, nsClass, nsType}, node)
 	rule, _ = cpolicy.NewStringRule("dev_path", false, "/dev")
 	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("sys_path", false)
+	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("device_naming", false, namingKernel)
+	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("attribute_db", false)
+	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("include_devices", false)
+	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("exclude_devices", false)
+	node.Add(rule)
+	rule, _ = cpolicy.NewStringRule("power_check", false, "never")
+	node.Add(rule)
+	rule3, _ := cpolicy.NewIntegerRule("power_check_max_skips", false, powerCheckMaxSkips)
+	node.Add(rule3)
+	rule, _ = cpolicy.NewStringRule("selftest_schedule", false)
+	node.Add(rule)
+	rule2, _ := cpolicy.NewBoolRule("read_only", false, false)
+	node.Add(rule2)
+	rule2, _ = cpolicy.NewBoolRule("enable_smart", false)
+	node.Add(rule2)
 	return cp, nil
 }
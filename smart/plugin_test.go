@@ -24,15 +24,19 @@ package smart
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/intelsdi-x/snap/control/plugin"
 	"github.com/intelsdi-x/snap/control/plugin/cpolicy"
 	"github.com/intelsdi-x/snap/core"
 	"github.com/intelsdi-x/snap/core/cdata"
+	"github.com/intelsdi-x/snap/core/ctypes"
 
 	log "github.com/sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
@@ -59,6 +63,14 @@ func (s *fakeSysutilProvider2) Ioctl(fd uintptr, cmd uint, buf []byte) error {
 	return nil
 }
 
+func (s *fakeSysutilProvider2) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	return nil
+}
+
+func (s *fakeSysutilProvider2) NvmeAdmin(fd uintptr, cmd *NvmeAdminCommand) error {
+	return nil
+}
+
 func sysUtilWithMetrics(metrics []byte) fakeSysutilProvider2 {
 	util := fakeSysutilProvider2{FillBuf: make([]byte, 512)}
 
@@ -135,6 +147,30 @@ func TestGetMetricTypes(t *testing.T) {
 
 			})
 
+			Convey("Attribute IDs and history samples should be dynamic elements", func() {
+
+				metrics, err := collector.GetMetricTypes(plugin.NewPluginConfigType())
+				So(err, ShouldBeNil)
+
+				dynamic := map[string]bool{}
+				for _, m := range metrics {
+					ns := m.Namespace()
+					switch ns.Strings()[4] {
+					case "id":
+						So(ns[5].IsDynamic(), ShouldBeTrue)
+						dynamic[ns[5].Name] = true
+					case "sct":
+						if len(ns) == 8 && ns[6].Value == "history" {
+							So(ns[7].IsDynamic(), ShouldBeTrue)
+							dynamic[ns[7].Name] = true
+						}
+					}
+				}
+
+				So(dynamic, ShouldResemble, map[string]bool{"attribute_id": true, "sample": true})
+
+			})
+
 			Reset(func() {
 				sysUtilProvider = orgProvider
 			})
@@ -189,8 +225,54 @@ func TestCollectMetrics(t *testing.T) {
 	Convey("Using fake system", t, func() {
 
 		orgReader := ReadSmartData
+		orgValuesReader := ReadSmartValues
+		orgThresholdsReader := ReadSmartThresholds
+		orgStatusReader := ReadSmartStatus
+		orgNvmeReader := ReadNvmeSmartLog
+		orgScsiReader := ReadScsiLogs
+		orgIdentityReader := ReadIdentity
+		orgPowerReader := ReadPowerMode
+		orgSelfTestReader := ReadSelfTestLog
+		orgErrorLogReader := ReadErrorLog
+		orgDevstatsReader := ReadDeviceStatistics
+		orgSctReader := ReadSctTemperatures
+		orgDeviceInfoReader := ReadDeviceInfo
 		orgProvider := sysUtilProvider
 
+		ReadSmartThresholds = func(device string,
+			sysutilProvider SysutilProvider) (*SmartThresholds, error) {
+			return &SmartThresholds{}, nil
+		}
+		ReadSmartStatus = func(device string,
+			sysutilProvider SysutilProvider) (bool, error) {
+			return true, nil
+		}
+		ReadScsiLogs = func(device string,
+			sysutilProvider SysutilProvider) (ScsiLogs, error) {
+			return nil, errors.New("not SCSI device")
+		}
+		ReadIdentity = func(device string,
+			sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+			return &DeviceIdentity{Model: "MODEL", Serial: "SERIAL_" + device}, nil
+		}
+		ReadSelfTestLog = func(device string,
+			sysutilProvider SysutilProvider) (*SelfTestLog, error) {
+			return &SelfTestLog{}, nil
+		}
+		ReadDeviceStatistics = func(device string,
+			sysutilProvider SysutilProvider) (DeviceStatistics, error) {
+			return DeviceStatistics{}, nil
+		}
+		ReadSctTemperatures = func(device string,
+			sysutilProvider SysutilProvider) (*SctTemperatures, error) {
+			return &SctTemperatures{}, nil
+		}
+		errorCount := uint16(3)
+		ReadErrorLog = func(device string,
+			sysutilProvider SysutilProvider) (*ErrorLog, error) {
+			return &ErrorLog{Count: errorCount}, nil
+		}
+
 		sc := SmartCollector{
 			logger:           log.New(),
 			initializedMutex: new(sync.Mutex),
@@ -328,9 +410,810 @@ func TestCollectMetrics(t *testing.T) {
 
 		})
 
+		Convey("When asked about threshold of metric", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				result := SmartValues{}
+				result.Values[0].Id = metric_id
+				result.Values[0].Data = 5
+
+				return &result, nil
+			}
+			ReadSmartThresholds = func(device string,
+				sysutilProvider SysutilProvider) (*SmartThresholds, error) {
+				result := SmartThresholds{}
+				result.Values[0].Id = metric_id
+				result.Values[0].Threshold = 5
+
+				return &result, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sda").AddStaticElements(metric_ns...).AddStaticElement("failing"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Returns failing state of attribute", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Data(), ShouldEqual, true)
+			})
+
+		})
+
+		Convey("When devices are accessed read-only", func() {
+
+			cfg.AddItem("read_only", ctypes.ConfigValueBool{Value: true})
+			enabled := false
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				enabled = true
+				return &SmartValues{}, nil
+			}
+			ReadSmartValues = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return &SmartValues{}, nil
+			}
+
+			_, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "health", "passed"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("SMART is not enabled", func() {
+				So(err, ShouldBeNil)
+				So(enabled, ShouldBeFalse)
+			})
+
+			Convey("Unless requested explicitly", func() {
+
+				sc.initialized = false
+				cfg.AddItem("enable_smart", ctypes.ConfigValueBool{Value: true})
+
+				_, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "health", "passed"),
+						Config_:    cfg,
+					},
+				})
+
+				So(err, ShouldBeNil)
+				So(enabled, ShouldBeTrue)
+
+			})
+
+		})
+
+		Convey("When disks in standby are not read", func() {
+
+			sc.power_check = PowerModeStandby
+			sc.power_check_max_skips = 2
+			reads := 0
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				reads++
+				return &SmartValues{}, nil
+			}
+			mode := PowerModeStandby
+			ReadPowerMode = func(device string,
+				sysutilProvider SysutilProvider) (PowerMode, error) {
+				return mode, nil
+			}
+			collect := func() []plugin.MetricType {
+				metrics, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "powermode"),
+						Config_:    cfg,
+					},
+				})
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				return metrics
+			}
+
+			Convey("Disk in standby is skipped", func() {
+				metrics := collect()
+				So(metrics[0].Data(), ShouldEqual, "standby")
+				So(reads, ShouldEqual, 0)
+			})
+
+			Convey("Skipped disk is not reported as read successfully", func() {
+				status := func() map[string]interface{} {
+					metrics, err := sc.CollectMetrics([]plugin.MetricType{
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "collector", "skipped"),
+							Config_:    cfg,
+						},
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "collector", "last_success"),
+							Config_:    cfg,
+						},
+					})
+					So(err, ShouldBeNil)
+					So(len(metrics), ShouldEqual, 2)
+					return map[string]interface{}{"skipped": metrics[0].Data(), "last_success": metrics[1].Data()}
+				}
+				So(status(), ShouldResemble, map[string]interface{}{"skipped": true, "last_success": int64(0)})
+				mode = PowerModeActive
+				read := status()
+				So(read["skipped"], ShouldEqual, false)
+				So(read["last_success"], ShouldBeGreaterThan, 0)
+				mode = PowerModeStandby
+				So(status()["last_success"], ShouldEqual, read["last_success"])
+			})
+
+			Convey("Disk is read after maximum number of skips", func() {
+				collect()
+				collect()
+				So(reads, ShouldEqual, 0)
+				collect()
+				So(reads, ShouldEqual, 1)
+				collect()
+				So(reads, ShouldEqual, 1)
+			})
+
+			Convey("Active disk is read", func() {
+				mode = PowerModeActive
+				metrics := collect()
+				So(metrics[0].Data(), ShouldEqual, "active")
+				So(reads, ShouldEqual, 1)
+			})
+
+			Convey("Disk which stops responding is reported as failed", func() {
+				mode = PowerModeActive
+				collect()
+				ReadPowerMode = func(device string,
+					sysutilProvider SysutilProvider) (PowerMode, error) {
+					return PowerModeUnknown, openError(device)
+				}
+				metrics, _ := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "powermode"),
+						Config_:    cfg,
+					},
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "collector", "up"),
+						Config_:    cfg,
+					},
+				})
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Data(), ShouldEqual, false)
+				So(reads, ShouldEqual, 1)
+			})
+
+			Convey("Skipped disk is not identified", func() {
+				identified := false
+				ReadIdentity = func(device string,
+					sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+					identified = true
+					return &DeviceIdentity{Model: "INTEL SSDSC2BB480G4"}, nil
+				}
+				metrics := collect()
+				So(metrics[0].Data(), ShouldEqual, "standby")
+				So(identified, ShouldBeFalse)
+			})
+
+			Convey("Disk which never responded is read", func() {
+				ReadPowerMode = func(device string,
+					sysutilProvider SysutilProvider) (PowerMode, error) {
+					return PowerModeUnknown, errors.New("not supported")
+				}
+				metrics := collect()
+				So(metrics[0].Data(), ShouldEqual, "unknown")
+				So(reads, ShouldEqual, 1)
+			})
+
+		})
+
+		Convey("When self-test is scheduled", func() {
+
+			sc.selftest_scheduler, _ = ParseSelfTestSchedules("short@* * * * *")
+			sc.selftest_scheduler.Due("sda", time.Now().Add(-2*time.Minute))
+			orgExecutor := ExecuteSelfTest
+			started := []byte{}
+			ExecuteSelfTest = func(device string, test byte,
+				sysutilProvider SysutilProvider) error {
+				started = append(started, test)
+				return nil
+			}
+			status := byte(0x00)
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return &SmartValues{SelfTestStatus: status}, nil
+			}
+			collect := func(attribute string) interface{} {
+				metrics, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "selftest").AddStaticElements(strings.Split(attribute, "/")...),
+						Config_:    cfg,
+					},
+				})
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				return metrics[0].Data()
+			}
+
+			Convey("Test is started", func() {
+				So(collect("in_progress"), ShouldEqual, false)
+				So(started, ShouldResemble, []byte{selftest_short})
+				So(sc.selftest_scheduler.LastStarted("sda").IsZero(), ShouldBeFalse)
+				So(collect("scheduled/last_started"), ShouldEqual, sc.selftest_scheduler.LastStarted("sda").Unix())
+			})
+
+			Convey("Test is not started while other one is in progress", func() {
+				status = 0xf4
+				So(collect("in_progress"), ShouldEqual, true)
+				So(collect("remaining_percent"), ShouldEqual, 40)
+				So(started, ShouldBeEmpty)
+			})
+
+			Reset(func() {
+				ExecuteSelfTest = orgExecutor
+			})
+
+		})
+
+		Convey("When device logs new errors", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return &SmartValues{}, nil
+			}
+			collect := func() []plugin.MetricType {
+				metrics, _ := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "errorlog", "new"),
+						Config_:    cfg,
+					},
+				})
+				return metrics
+			}
+
+			Convey("Number of errors since previous collection is published", func() {
+				So(collect(), ShouldBeEmpty)
+				errorCount = 5
+				metrics := collect()
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Data(), ShouldEqual, 2)
+				metrics = collect()
+				So(metrics[0].Data(), ShouldEqual, 0)
+			})
+
+			Convey("Decrease of error count is not published as new errors", func() {
+				errorCount = 0xffff
+				collect()
+				errorCount = 1
+				So(collect(), ShouldBeEmpty)
+				errorCount = 4
+				So(collect()[0].Data(), ShouldEqual, 3)
+			})
+
+		})
+
+		Convey("When asked about health of all disks", func() {
+
+			sysUtilProvider = &fakeSysutilProvider2{}
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return &SmartValues{}, nil
+			}
+			ReadSmartStatus = func(device string,
+				sysutilProvider SysutilProvider) (bool, error) {
+				return device == "DEV_ONE", nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "health", "passed"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Returns health of every listed disk", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 2)
+				for _, m := range metrics {
+					So(m.Data(), ShouldEqual, m.Namespace()[3].Value == "DEV_ONE")
+				}
+			})
+
+			Convey("Status of collection is published for every disk", func() {
+
+				sc.statuses = nil
+				ReadSmartData = func(device string,
+					sysutilProvider SysutilProvider) (*SmartValues, error) {
+					if device == "DEV_TWO" {
+						return nil, openError(device)
+					}
+					return &SmartValues{}, nil
+				}
+				collect := func() map[string]interface{} {
+					metrics, err := sc.CollectMetrics([]plugin.MetricType{
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "collector", "up"),
+							Config_:    cfg,
+						},
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "collector", "error_code"),
+							Config_:    cfg,
+						},
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "collector", "last_success"),
+							Config_:    cfg,
+						},
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "collector", "checksum_errors"),
+							Config_:    cfg,
+						},
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "health", "passed"),
+							Config_:    cfg,
+						},
+					})
+					So(err, ShouldBeNil)
+					values := map[string]interface{}{}
+					for _, m := range metrics {
+						values[strings.Join(m.Namespace().Strings()[3:], "/")] = m.Data()
+					}
+					return values
+				}
+
+				values := collect()
+				So(len(values), ShouldEqual, 9)
+				So(values["DEV_ONE/collector/up"], ShouldEqual, true)
+				So(values["DEV_ONE/collector/error_code"], ShouldEqual, ErrorNone)
+				So(values["DEV_ONE/collector/last_success"], ShouldBeGreaterThan, 0)
+				So(values["DEV_TWO/collector/up"], ShouldEqual, false)
+				So(values["DEV_TWO/collector/error_code"], ShouldEqual, ErrorOpenFailed)
+				So(values["DEV_TWO/collector/last_success"], ShouldEqual, 0)
+
+				ReadSmartData = func(device string,
+					sysutilProvider SysutilProvider) (*SmartValues, error) {
+					return nil, readError(device, "S.M.A.R.T Reading", errors.New("EIO"))
+				}
+				last_success := values["DEV_ONE/collector/last_success"]
+				values = collect()
+				So(len(values), ShouldEqual, 8)
+				So(values["DEV_ONE/collector/error_code"], ShouldEqual, ErrorIoctlFailed)
+				So(values["DEV_ONE/collector/last_success"], ShouldEqual, last_success)
+				So(values["DEV_ONE/collector/checksum_errors"], ShouldEqual, 0)
+
+				identified := []string{}
+				ReadIdentity = func(device string,
+					sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+					identified = append(identified, device)
+					return nil, openError(device)
+				}
+				collect()
+				So(identified, ShouldBeEmpty)
+
+				ReadSmartData = func(device string,
+					sysutilProvider SysutilProvider) (*SmartValues, error) {
+					_, err := ParseSmartValues(make([]byte, 511))
+					return nil, readError(device, "S.M.A.R.T Reading", err)
+				}
+				collect()
+				values = collect()
+				So(values["DEV_ONE/collector/error_code"], ShouldEqual, ErrorChecksum)
+				So(values["DEV_ONE/collector/checksum_errors"], ShouldEqual, 2)
+
+			})
+
+			Convey("Filtered disks are not read", func() {
+
+				ReadDeviceInfo = func(sysPath, devPath, name string) DeviceInfo {
+					return DeviceInfo{Name: name, Model: "MODEL_" + name, ById: []string{"usb-" + name}}
+				}
+				read := []string{}
+				ReadSmartData = func(device string,
+					sysutilProvider SysutilProvider) (*SmartValues, error) {
+					read = append(read, device)
+					return &SmartValues{}, nil
+				}
+				collect := func(include, exclude string) []plugin.MetricType {
+					read = []string{}
+					sc.initialized = false
+					cfg := cdata.NewNode()
+					cfg.AddItem("include_devices", ctypes.ConfigValueStr{Value: include})
+					cfg.AddItem("exclude_devices", ctypes.ConfigValueStr{Value: exclude})
+					metrics, _ := sc.CollectMetrics([]plugin.MetricType{
+						{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "health", "passed"),
+							Config_:    cfg,
+						},
+					})
+					return metrics
+				}
+
+				metrics := collect("", "usb-*")
+				So(metrics, ShouldBeEmpty)
+				So(read, ShouldBeEmpty)
+
+				metrics = collect("/_TWO$/", "")
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Namespace()[3].Value, ShouldEqual, "DEV_TWO")
+				So(read, ShouldResemble, []string{"DEV_TWO"})
+
+				metrics = collect("MODEL_*", "DEV_ONE")
+				So(len(metrics), ShouldEqual, 1)
+				So(read, ShouldResemble, []string{"DEV_TWO"})
+
+			})
+
+			Convey("Filter is evaluated once per device in collection", func() {
+
+				lookups := 0
+				ReadDeviceInfo = func(sysPath, devPath, name string) DeviceInfo {
+					lookups++
+					return DeviceInfo{Name: name}
+				}
+				sc.initialized = false
+				cfg := cdata.NewNode()
+				cfg.AddItem("exclude_devices", ctypes.ConfigValueStr{Value: "DEV_ONE"})
+				metrics, _ := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "health", "passed"),
+						Config_:    cfg,
+					},
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "*", "collector", "up"),
+						Config_:    cfg,
+					},
+				})
+
+				So(len(metrics), ShouldEqual, 2)
+				So(lookups, ShouldEqual, 2)
+
+			})
+
+		})
+
+		Convey("When asked about derived metric", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				result := SmartValues{}
+				result.Values[0].Id = 0x09
+				result.Values[0].Raw[0] = 2
+
+				return &result, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "derived", "power_on_seconds"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Returns value in common unit", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Data(), ShouldEqual, 7200)
+				So(metrics[0].Unit(), ShouldEqual, "s")
+			})
+
+		})
+
+		Convey("When asked about metric of NVMe controller", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return nil, errors.New("not ATA device")
+			}
+			ReadNvmeSmartLog = func(device string,
+				sysutilProvider SysutilProvider) (*NvmeSmartLog, error) {
+				return &NvmeSmartLog{PercentageUsed: 7}, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "nvme0", "nvme", "percentageused"),
+					Config_:    cfg,
+				},
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "nvme0", "health", "passed"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Returns values from NVMe SMART log", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Data(), ShouldEqual, 7)
+				So(metrics[1].Data(), ShouldEqual, true)
+			})
+
+		})
+
+		Convey("When asked about metric of device without ATA SMART", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return nil, unsupportedError("not ATA device")
+			}
+			ReadScsiLogs = func(device string,
+				sysutilProvider SysutilProvider) (ScsiLogs, error) {
+				return ScsiLogs{scsi_log_temperature: {{Code: 0, Value: []byte{0, 35}}}}, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sdc", "scsi", "temperature"),
+					Config_:    cfg,
+				},
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sdc", "health", "passed"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Returns values from SCSI log pages", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Data(), ShouldEqual, 35)
+			})
+
+		})
+
+		Convey("When ATA SMART data of device with SCSI log pages is corrupt", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				return nil, corruptError("S.M.A.R.T data")
+			}
+			ReadScsiLogs = func(device string,
+				sysutilProvider SysutilProvider) (ScsiLogs, error) {
+				return ScsiLogs{scsi_log_temperature: {{Code: 0, Value: []byte{0, 35}}}}, nil
+			}
+			sc.statuses = nil
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sdc", "scsi", "temperature"),
+					Config_:    cfg,
+				},
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sdc", "collector", "checksum_errors"),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Reports corrupt data instead of SCSI log pages", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Namespace().Strings(), ShouldContain, "checksum_errors")
+				So(metrics[0].Data(), ShouldEqual, 1)
+			})
+
+		})
+
+		Convey("When asked about attributes by any ID", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				result := SmartValues{}
+				result.Values[0].Id = 0x05
+				result.Values[0].Raw[0] = 3
+				result.Values[1].Id = 0xc2
+				result.Values[1].Raw[0] = 35
+
+				return &result, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "id").
+						AddDynamicElement("attribute_id", "").AddStaticElement("raw"),
+					Config_: cfg,
+				},
+			})
+
+			Convey("Returns value of each attribute present", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 2)
+				So(metrics[0].Namespace().Strings(), ShouldResemble, []string{"intel", "disk", "smart", "sda", "id", "005", "raw"})
+				So(metrics[0].Data(), ShouldEqual, 3)
+				So(metrics[1].Namespace().Strings(), ShouldResemble, []string{"intel", "disk", "smart", "sda", "id", "194", "raw"})
+				So(metrics[1].Data(), ShouldEqual, 35)
+			})
+
+		})
+
+		Convey("When asked about metric of identified disk", func() {
+
+			ReadSmartData = func(device string,
+				sysutilProvider SysutilProvider) (*SmartValues, error) {
+				result := SmartValues{}
+				result.Values[0].Id = metric_id
+
+				return &result, nil
+			}
+
+			metrics, err := sc.CollectMetrics([]plugin.MetricType{
+				{
+					Namespace_: core.NewNamespace("intel", "disk", "smart", "sda").AddStaticElements(metric_ns...),
+					Config_:    cfg,
+				},
+			})
+
+			Convey("Metric is tagged with identity of disk", func() {
+				So(err, ShouldBeNil)
+				So(len(metrics), ShouldEqual, 1)
+				So(metrics[0].Tags(), ShouldResemble, map[string]string{
+					"model":  "MODEL",
+					"serial": "SERIAL_sda",
+				})
+			})
+
+			Convey("And disk is described by attribute definition database", func() {
+
+				db, _ := ParseAttributeDb([]byte(attributeDbFixture))
+				sc.attribute_db = db
+				sc.identities = nil
+				ReadIdentity = func(device string,
+					sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+					return &DeviceIdentity{Model: "ST4000NM0033", Firmware: "SN04"}, nil
+				}
+				ReadSmartData = func(device string,
+					sysutilProvider SysutilProvider) (*SmartValues, error) {
+					result := SmartValues{}
+					result.Values[0].Id = 1
+					result.Values[0].Data = 117
+
+					return &result, nil
+				}
+
+				metrics, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "sda", "readerrorrate", "normalized"),
+						Config_:    cfg,
+					},
+				})
+
+				Convey("Attribute is named according to database", func() {
+					So(err, ShouldBeNil)
+					So(len(metrics), ShouldEqual, 1)
+					So(metrics[0].Data(), ShouldEqual, 117)
+				})
+
+			})
+
+			Convey("And disks are named by serial number", func() {
+
+				sysUtilProvider = &fakeSysutilProvider2{}
+				sc.device_naming = namingSerial
+
+				metrics, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "*").AddStaticElements(metric_ns...),
+						Config_:    cfg,
+					},
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "SERIAL_DEV_TWO").AddStaticElements(metric_ns...),
+						Config_:    cfg,
+					},
+				})
+
+				Convey("Serial number is used in namespace", func() {
+					So(err, ShouldBeNil)
+					So(len(metrics), ShouldEqual, 3)
+					So(metrics[0].Namespace()[3].Value, ShouldEqual, "SERIAL_DEV_ONE")
+					So(metrics[1].Namespace()[3].Value, ShouldEqual, "SERIAL_DEV_TWO")
+					So(metrics[2].Namespace()[3].Value, ShouldEqual, "SERIAL_DEV_TWO")
+				})
+
+			})
+
+			Convey("And disk is requested by serial number", func() {
+
+				sysUtilProvider = &fakeSysutilProvider2{}
+				sc.device_naming = namingSerial
+				ReadDeviceInfo = func(sysPath, devPath, name string) DeviceInfo {
+					return DeviceInfo{Name: name, ById: []string{"ata-MODEL_SERIAL_" + name}}
+				}
+				identified := []string{}
+				ReadIdentity = func(device string,
+					sysutilProvider SysutilProvider) (*DeviceIdentity, error) {
+					identified = append(identified, device)
+					return &DeviceIdentity{Model: "MODEL", Serial: "SERIAL_" + device}, nil
+				}
+
+				metrics, err := sc.CollectMetrics([]plugin.MetricType{
+					{
+						Namespace_: core.NewNamespace("intel", "disk", "smart", "SERIAL_DEV_TWO").AddStaticElements(metric_ns...),
+						Config_:    cfg,
+					},
+				})
+
+				Convey("Only that disk is opened", func() {
+					So(err, ShouldBeNil)
+					So(len(metrics), ShouldEqual, 1)
+					So(metrics[0].Namespace()[3].Value, ShouldEqual, "SERIAL_DEV_TWO")
+					So(identified, ShouldResemble, []string{"DEV_TWO"})
+				})
+
+			})
+
+			Convey("And disks are named by persistent links", func() {
+
+				dir, err := ioutil.TempDir("", "smart")
+				So(err, ShouldBeNil)
+				for link, target := range map[string]string{
+					"by-id/ata-MODEL_SERIAL_DEV_ONE": "../../DEV_ONE",
+					"by-id/wwn-0x5000c500":           "../../DEV_ONE",
+					"by-path/pci-0000:00:1f.2-ata-1": "../../DEV_ONE",
+				} {
+					path := filepath.Join(dir, "disk", link)
+					So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+					So(os.Symlink(target, path), ShouldBeNil)
+				}
+
+				sysUtilProvider = &fakeSysutilProvider2{}
+				sc.dev_path = dir
+				collect := func(naming string, disks ...string) []string {
+					sc.device_naming = naming
+					mts := []plugin.MetricType{}
+					for _, disk := range disks {
+						mts = append(mts, plugin.MetricType{
+							Namespace_: core.NewNamespace("intel", "disk", "smart", disk).AddStaticElements(metric_ns...),
+							Config_:    cfg,
+						})
+					}
+					metrics, err := sc.CollectMetrics(mts)
+					So(err, ShouldBeNil)
+					names := []string{}
+					for _, m := range metrics {
+						names = append(names, m.Namespace()[3].Value)
+					}
+					return names
+				}
+
+				Convey("Link name is used in namespace", func() {
+					So(collect(namingById, "*"), ShouldResemble, []string{"ata-MODEL_SERIAL_DEV_ONE", "DEV_TWO"})
+					So(collect(namingByPath, "*"), ShouldResemble, []string{"pci-0000:00:1f.2-ata-1", "DEV_TWO"})
+				})
+
+				Convey("Any form of name is accepted for specific disk", func() {
+					So(collect(namingByPath, "ata-MODEL_SERIAL_DEV_ONE", "0x5000c500", "DEV_ONE"),
+						ShouldResemble, []string{"pci-0000:00:1f.2-ata-1", "pci-0000:00:1f.2-ata-1", "pci-0000:00:1f.2-ata-1"})
+					So(collect(namingKernel, "pci-0000:00:1f.2-ata-1", "wwn-0x5000c500"),
+						ShouldResemble, []string{"DEV_ONE", "DEV_ONE"})
+				})
+
+				Convey("WWN is taken from link when disk does not report it", func() {
+					So(collect(namingWwn, "*"), ShouldResemble, []string{"0x5000c500", "DEV_TWO"})
+				})
+
+				Reset(func() {
+					os.RemoveAll(dir)
+				})
+
+			})
+
+		})
+
 		Reset(func() {
 			sysUtilProvider = orgProvider
+			ReadIdentity = orgIdentityReader
+			ReadPowerMode = orgPowerReader
+			ReadSelfTestLog = orgSelfTestReader
+			ReadErrorLog = orgErrorLogReader
+			ReadDeviceStatistics = orgDevstatsReader
+			ReadSctTemperatures = orgSctReader
+			ReadDeviceInfo = orgDeviceInfoReader
+			ReadScsiLogs = orgScsiReader
+			ReadNvmeSmartLog = orgNvmeReader
 			ReadSmartData = orgReader
+			ReadSmartValues = orgValuesReader
+			ReadSmartThresholds = orgThresholdsReader
+			ReadSmartStatus = orgStatusReader
 		})
 
 	})
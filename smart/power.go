@@ -0,0 +1,97 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+const (
+	ata_check_power_mode = 0xe5
+
+	// Values of count register returned by CHECK POWER MODE
+	ata_power_standby   = 0x00
+	ata_power_standby_y = 0x01
+	ata_power_idle      = 0x80
+	ata_power_idle_a    = 0x81
+	ata_power_idle_b    = 0x82
+	ata_power_idle_c    = 0x83
+	ata_power_nv_cache  = 0x40
+	ata_power_nv_active = 0x41
+	ata_power_active    = 0xff
+)
+
+// PowerMode describes power state of drive. Modes are ordered from the most
+// to the least power consuming one.
+type PowerMode int
+
+const (
+	PowerModeUnknown PowerMode = iota
+	PowerModeActive
+	PowerModeIdle
+	PowerModeStandby
+	PowerModeSleep
+)
+
+// Names of power modes, used as value of powermode metric and in
+// power_check option.
+var powerModeNames = map[PowerMode]string{
+	PowerModeUnknown: "unknown",
+	PowerModeActive:  "active",
+	PowerModeIdle:    "idle",
+	PowerModeStandby: "standby",
+	PowerModeSleep:   "sleep",
+}
+
+func (m PowerMode) String() string {
+	return powerModeNames[m]
+}
+
+// ParsePowerMode decodes count register returned by CHECK POWER MODE.
+func ParsePowerMode(count byte) PowerMode {
+	switch count {
+	case ata_power_standby, ata_power_standby_y:
+		return PowerModeStandby
+	case ata_power_idle, ata_power_idle_a, ata_power_idle_b, ata_power_idle_c:
+		return PowerModeIdle
+	case ata_power_active, ata_power_nv_cache, ata_power_nv_active:
+		return PowerModeActive
+	}
+	return PowerModeUnknown
+}
+
+// ReadPowerMode_ checks power mode of drive using CHECK POWER MODE, which
+// does not spin up drive. Drive in sleep mode does not respond to commands,
+// so failure of the command is reported as error.
+func ReadPowerMode_(device string, sysutilProvider SysutilProvider) (PowerMode, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return PowerModeUnknown, openError(device)
+	}
+	defer f.Close()
+
+	cmd := AtaCommand{Command: ata_check_power_mode, Registers: true}
+	if err := NewAtaTransport(sysutilProvider, device).AtaCommand(f.Fd(), &cmd); err != nil {
+		return PowerModeUnknown, readError(device, "power mode check", err)
+	}
+
+	return ParsePowerMode(cmd.Count), nil
+}
+
+// Introduced to make mocking possible. See ReadPowerMode_.
+var ReadPowerMode = ReadPowerMode_
@@ -0,0 +1,89 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParsePowerMode(t *testing.T) {
+	Convey("Decoding count register of CHECK POWER MODE", t, func() {
+
+		for count, mode := range map[byte]PowerMode{
+			0x00: PowerModeStandby,
+			0x01: PowerModeStandby,
+			0x80: PowerModeIdle,
+			0x83: PowerModeIdle,
+			0x40: PowerModeActive,
+			0xff: PowerModeActive,
+			0x10: PowerModeUnknown,
+		} {
+			So(ParsePowerMode(count), ShouldEqual, mode)
+		}
+
+	})
+}
+
+func TestReadPowerMode(t *testing.T) {
+	Convey("Reading power mode of drive in standby", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   []byte{0x50, 0, ata_power_standby, 0, 0, 0, 0}}
+		mode, err := ReadPowerMode("MYDEV", provider)
+
+		Convey("Should ask for power mode using drive task", func() {
+
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(provider.IoctlArgs[0].cmd, ShouldEqual, hdio_drive_task)
+
+		})
+
+		Convey("Should report standby mode", func() {
+
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, PowerModeStandby)
+			So(mode.String(), ShouldEqual, "standby")
+
+		})
+
+	})
+
+	Convey("When drive does not respond", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{errors.New("Something")}}
+		mode, err := ReadPowerMode("MYDEV", provider)
+
+		Convey("Should report error", func() {
+
+			So(err, ShouldNotBeNil)
+			So(mode, ShouldEqual, PowerModeUnknown)
+
+		})
+
+	})
+}
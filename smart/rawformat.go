@@ -0,0 +1,160 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+// Offset of reserved byte following raw data of attribute, which some
+// formats use as the most significant byte of raw value
+const raw_reserved_offset = 6
+
+// rawField describes value stored in bytes of attribute's raw data. Values
+// are unsigned integers, published as uint64, or as float64 divided by
+// Divisor when it is given (e.g. to convert minutes to hours).
+type rawField struct {
+	Key     string
+	Offset  int
+	Length  int
+	Divisor float64
+}
+
+// decode extracts little-endian value of field from raw data followed by
+// reserved byte.
+func (f rawField) decode(data [7]byte) interface{} {
+	var v uint64
+	for i := 0; i < f.Length; i++ {
+		v |= uint64(data[f.Offset+i]) << (8 * uint(i))
+	}
+	if f.Divisor != 0 {
+		return float64(v) / f.Divisor
+	}
+	return v
+}
+
+// Layouts of raw data of supported formats. Main value has empty key,
+// additional values have keys appended to name of attribute.
+var rawLayouts = map[AttributeFormat][]rawField{
+	FormatDefault: {
+		{Key: "", Offset: 0, Length: 6},
+	},
+	FormatFP1024: {
+		{Key: "", Offset: 0, Length: 6, Divisor: 1024},
+	},
+	FormatPLPF: {
+		{Key: "", Offset: 0, Length: 2},
+		{Key: "/sincelast", Offset: 2, Length: 2},
+		{Key: "/tests", Offset: 4, Length: 2},
+	},
+	FormatTemperature: {
+		{Key: "", Offset: 0, Length: 2},
+		{Key: "/min", Offset: 2, Length: 1},
+		{Key: "/max", Offset: 3, Length: 1},
+		{Key: "/overcounter", Offset: 4, Length: 2},
+	},
+	FormatTTS: {
+		{Key: "", Offset: 0, Length: 1},
+		{Key: "/eventcount", Offset: 1, Length: 4},
+	},
+	FormatRaw48: {
+		{Key: "", Offset: 0, Length: 6},
+	},
+	FormatRaw16Avg16: {
+		{Key: "", Offset: 0, Length: 2},
+		{Key: "/average", Offset: 2, Length: 2},
+	},
+	FormatRaw24Raw24: {
+		{Key: "", Offset: 3, Length: 3},
+		{Key: "/divisor", Offset: 0, Length: 3},
+	},
+	// Hexadecimal in smartctl output, value itself is the same as raw48
+	FormatHex48: {
+		{Key: "", Offset: 0, Length: 6},
+	},
+	// Word 2 is shown by smartctl in parentheses, its meaning is unknown
+	FormatMin2Hour: {
+		{Key: "", Offset: 0, Length: 4, Divisor: 60},
+	},
+	FormatSec2Hour: {
+		{Key: "", Offset: 0, Length: 6, Divisor: 3600},
+	},
+	FormatHalfMin2Hour: {
+		{Key: "", Offset: 0, Length: 6, Divisor: 120},
+	},
+	FormatMsec24Hour32: {
+		{Key: "", Offset: 0, Length: 4},
+		{Key: "/milliseconds", Offset: 4, Length: 3},
+	},
+	// Layout used by Maxtor, Samsung, Seagate and Toshiba drives, and WDC
+	// drives reporting over temperature count
+	FormatTempMinMax: {
+		{Key: "", Offset: 0, Length: 1},
+		{Key: "/min", Offset: 2, Length: 1},
+		{Key: "/max", Offset: 3, Length: 1},
+		{Key: "/overcounter", Offset: 4, Length: 2},
+	},
+	FormatTemp10x: {
+		{Key: "", Offset: 0, Length: 2, Divisor: 10},
+	},
+	FormatRaw16Raw16: {
+		{Key: "", Offset: 0, Length: 2},
+		{Key: "/word1", Offset: 2, Length: 2},
+		{Key: "/word2", Offset: 4, Length: 2},
+	},
+}
+
+// Parses 6 bytes of raw data in a way specific to this format.
+// It returns map of values. Main value is accessible using empty string.
+// Additional values are accessible using "/[additonal value]"
+func (a AttributeFormat) ParseRaw(data [6]byte) map[string]interface{} {
+	return a.parse(data, 0)
+}
+
+// ParseValue works as ParseRaw, but also uses reserved byte of attribute,
+// which extends raw value in some formats (e.g. msec24hour32).
+func (a AttributeFormat) ParseValue(v SmartValue) map[string]interface{} {
+	return a.parse(v.Raw, v.Reserved)
+}
+
+func (a AttributeFormat) parse(raw [6]byte, reserved byte) map[string]interface{} {
+	layout, ok := rawLayouts[a]
+	if !ok {
+		return nil
+	}
+	data := [7]byte{}
+	copy(data[:], raw[:])
+	data[raw_reserved_offset] = reserved
+	ret_val := map[string]interface{}{}
+	for _, f := range layout {
+		ret_val[f.Key] = f.decode(data)
+	}
+	return ret_val
+}
+
+// GetKeys returns list of keys that can be used to access parsed values
+// of particular format.
+func (a AttributeFormat) GetKeys() []string {
+	ret := []string{"", "/normalized"}
+	for _, f := range rawLayouts[a] {
+		if f.Key != "" {
+			ret = append(ret, f.Key)
+		}
+	}
+	return ret
+}
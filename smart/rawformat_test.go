@@ -0,0 +1,189 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"testing/quick"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// le48 is reference decoding of 48-bit little endian raw value.
+func le48(data [6]byte) uint64 {
+	buf := make([]byte, 8)
+	copy(buf, data[:])
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func TestRawFormatReferenceValues(t *testing.T) {
+
+	raw := [6]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	reference := map[AttributeFormat]map[string]interface{}{
+		FormatDefault: {"": uint64(0x060504030201)},
+		FormatFP1024:  {"": float64(0x060504030201) / 1024},
+		FormatPLPF: {
+			"":           uint64(0x0201),
+			"/sincelast": uint64(0x0403),
+			"/tests":     uint64(0x0605),
+		},
+		FormatTemperature: {
+			"":             uint64(0x0201),
+			"/min":         uint64(0x03),
+			"/max":         uint64(0x04),
+			"/overcounter": uint64(0x0605),
+		},
+		FormatTTS: {
+			"":            uint64(0x01),
+			"/eventcount": uint64(0x05040302),
+		},
+		FormatRaw48: {"": uint64(0x060504030201)},
+		FormatRaw16Avg16: {
+			"":         uint64(0x0201),
+			"/average": uint64(0x0403),
+		},
+		FormatRaw24Raw24: {
+			"":         uint64(0x060504),
+			"/divisor": uint64(0x030201),
+		},
+		FormatHex48:        {"": uint64(0x060504030201)},
+		FormatMin2Hour:     {"": float64(0x04030201) / 60},
+		FormatSec2Hour:     {"": float64(0x060504030201) / 3600},
+		FormatHalfMin2Hour: {"": float64(0x060504030201) / 120},
+		FormatMsec24Hour32: {
+			"":              uint64(0x04030201),
+			"/milliseconds": uint64(0x0605),
+		},
+		FormatTempMinMax: {
+			"":             uint64(0x01),
+			"/min":         uint64(0x03),
+			"/max":         uint64(0x04),
+			"/overcounter": uint64(0x0605),
+		},
+		FormatTemp10x: {"": float64(0x0201) / 10},
+		FormatRaw16Raw16: {
+			"":       uint64(0x0201),
+			"/word1": uint64(0x0403),
+			"/word2": uint64(0x0605),
+		},
+	}
+
+	for format, expected := range reference {
+		Convey(fmt.Sprintf("Parsing raw data of format %d", format), t, func() {
+			So(format.ParseRaw(raw), ShouldResemble, expected)
+		})
+	}
+
+	Convey("Counters above 2^40 are decoded", t, func() {
+		data := [6]byte{0, 0, 0, 0, 0x01, 0x80}
+		So(FormatDefault.ParseRaw(data)[""], ShouldEqual, uint64(0x800100000000))
+		So(FormatFP1024.ParseRaw(data)[""], ShouldEqual, float64(0x800100000000)/1024)
+	})
+
+	Convey("Values are converted to units of smartctl output", t, func() {
+		So(FormatTemp10x.ParseRaw([6]byte{0x59, 0x01})[""], ShouldEqual, 34.5)
+		So(FormatMin2Hour.ParseRaw([6]byte{90, 0, 0, 0, 7, 0})[""], ShouldEqual, 1.5)
+		So(FormatSec2Hour.ParseRaw([6]byte{0x10, 0x0e})[""], ShouldEqual, 1)
+		So(FormatHalfMin2Hour.ParseRaw([6]byte{60})[""], ShouldEqual, 0.5)
+	})
+
+	Convey("Reserved byte extends milliseconds of msec24hour32 format", t, func() {
+		// 1234 hours and 3000000 ms
+		v := SmartValue{Raw: [6]byte{0xd2, 0x04, 0, 0, 0xc0, 0xc6}, Reserved: 0x2d}
+		So(FormatMsec24Hour32.ParseValue(v), ShouldResemble, map[string]interface{}{
+			"":              uint64(1234),
+			"/milliseconds": uint64(3000000),
+		})
+		So(FormatRaw48.ParseValue(v)[""], ShouldEqual, FormatRaw48.ParseRaw(v.Raw)[""])
+	})
+
+	Convey("Every format has name used in attribute definition database", t, func() {
+		named := map[AttributeFormat]bool{}
+		for name := range formatNames {
+			format, err := ParseAttributeFormat(name)
+			So(err, ShouldBeNil)
+			named[format] = true
+		}
+		for format := range rawLayouts {
+			So(named[format], ShouldBeTrue)
+		}
+	})
+
+	Convey("Every format has reference values", t, func() {
+		So(len(reference), ShouldEqual, len(rawLayouts))
+	})
+}
+
+func TestRawFormatProperties(t *testing.T) {
+
+	Convey("Default format decodes whole 48-bit value", t, func() {
+		err := quick.Check(func(data [6]byte) bool {
+			return FormatDefault.ParseRaw(data)[""] == le48(data)
+		}, nil)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("FP1024 format is default format divided by 1024", t, func() {
+		err := quick.Check(func(data [6]byte) bool {
+			return FormatFP1024.ParseRaw(data)[""] == float64(le48(data))/1024
+		}, nil)
+		So(err, ShouldBeNil)
+	})
+
+	for format, layout := range rawLayouts {
+		Convey(fmt.Sprintf("Layout of format %d", format), t, func() {
+
+			Convey("Fields are within raw data and reserved byte and have unique keys", func() {
+				keys := map[string]bool{}
+				for _, f := range layout {
+					So(f.Offset, ShouldBeGreaterThanOrEqualTo, 0)
+					So(f.Length, ShouldBeBetweenOrEqual, 1, 6)
+					So(f.Offset+f.Length, ShouldBeLessThanOrEqualTo, raw_reserved_offset+1)
+					So(keys[f.Key], ShouldBeFalse)
+					keys[f.Key] = true
+				}
+				So(keys[""], ShouldBeTrue)
+			})
+
+			Convey("Parsed values match keys and fit in their fields", func() {
+				err := quick.Check(func(data [6]byte) bool {
+					parsed := format.ParseRaw(data)
+					if len(parsed)+1 != len(format.GetKeys()) {
+						return false
+					}
+					for _, f := range layout {
+						v, ok := parsed[f.Key].(uint64)
+						if ok && v >= uint64(1)<<uint(8*f.Length) {
+							return false
+						}
+					}
+					return true
+				}, nil)
+				So(err, ShouldBeNil)
+			})
+
+		})
+	}
+}
@@ -0,0 +1,255 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbers of self-tests run in off-line mode, given in LBA low register of
+// SMART EXECUTE OFF-LINE IMMEDIATE.
+const (
+	selftest_short      = 0x01
+	selftest_extended   = 0x02
+	selftest_conveyance = 0x03
+)
+
+// Names of self-tests used in schedules.
+var selfTestNames = map[string]byte{
+	"short":      selftest_short,
+	"long":       selftest_extended,
+	"conveyance": selftest_conveyance,
+}
+
+// Order in which self-tests are preferred when more of them are due.
+var selfTestPriority = map[byte]int{
+	selftest_short:      1,
+	selftest_conveyance: 2,
+	selftest_extended:   3,
+}
+
+// Maximal period in which scheduled times are looked for, so disk which
+// was not checked for a long time does not stall collection.
+const scheduleLookback = 31 * 24 * time.Hour
+
+// cronField holds values allowed for single field of cron expression.
+type cronField map[int]bool
+
+// parseCronField decodes field given as *, */step, value, range,
+// range/step or comma separated list of them.
+func parseCronField(s string, min, max int) (cronField, error) {
+	field := cronField{}
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, errors.New(fmt.Sprintf("Invalid step in %s", part))
+			}
+			part = part[:i]
+		}
+		first, last := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if first, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid value %s", part))
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.New(fmt.Sprintf("Invalid range %s", part))
+				}
+			}
+		}
+		if first < min || last > max || first > last {
+			return nil, errors.New(fmt.Sprintf("%s out of range %d-%d", part, min, max))
+		}
+		for v := first; v <= last; v += step {
+			field[v] = true
+		}
+	}
+	return field, nil
+}
+
+// cronSpec describes times given by cron expression with minute, hour,
+// day of month, month and day of week fields. Time matches when all
+// fields match, except that as in cron it is enough for either day of
+// month or day of week to match when both of them are restricted, i.e.
+// do not start with *.
+type cronSpec struct {
+	minute, hour, day, month, weekday cronField
+	anyDay, anyWeekday                bool
+}
+
+func parseCronSpec(s string) (*cronSpec, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("Cron expression %q has to have 5 fields", s))
+	}
+	spec := &cronSpec{}
+	var err error
+	for i, f := range []struct {
+		field    *cronField
+		min, max int
+	}{
+		{&spec.minute, 0, 59},
+		{&spec.hour, 0, 23},
+		{&spec.day, 1, 31},
+		{&spec.month, 1, 12},
+		// Sunday is given either as 0 or as 7
+		{&spec.weekday, 0, 7},
+	} {
+		if *f.field, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return nil, errors.New(fmt.Sprintf("Cron expression %q: %v", s, err))
+		}
+	}
+	if spec.weekday[7] {
+		spec.weekday[0] = true
+	}
+	spec.anyDay = strings.HasPrefix(fields[2], "*")
+	spec.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return spec, nil
+}
+
+func (c *cronSpec) matches(t time.Time) bool {
+	day := c.day[t.Day()] && c.weekday[int(t.Weekday())]
+	if !c.anyDay && !c.anyWeekday {
+		day = c.day[t.Day()] || c.weekday[int(t.Weekday())]
+	}
+	return c.minute[t.Minute()] && c.hour[t.Hour()] && c.month[int(t.Month())] && day
+}
+
+// matchesBetween tells whether any minute in period (from, to] matches.
+func (c *cronSpec) matchesBetween(from, to time.Time) bool {
+	if to.Sub(from) > scheduleLookback {
+		from = to.Add(-scheduleLookback)
+	}
+	for t := from.Truncate(time.Minute).Add(time.Minute); !t.After(to); t = t.Add(time.Minute) {
+		if c.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelfTestSchedule tells when self-test of given type is run on device,
+// or on all devices if Device is empty.
+type SelfTestSchedule struct {
+	Device string
+	Test   byte
+	spec   *cronSpec
+}
+
+// SelfTestScheduler decides when scheduled self-tests are due. It tracks
+// when each device was checked and last started self-test.
+type SelfTestScheduler struct {
+	Schedules []SelfTestSchedule
+	checked   map[string]time.Time
+	started   map[string]time.Time
+}
+
+// ParseSelfTestSchedules decodes list of schedules separated by
+// semicolons, each given as [device:]test@cron expression, e.g.
+// "short@0 2 * * *; sda:long@0 3 * * 6".
+func ParseSelfTestSchedules(s string) (*SelfTestScheduler, error) {
+	scheduler := &SelfTestScheduler{
+		checked: map[string]time.Time{},
+		started: map[string]time.Time{},
+	}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		at := strings.Index(entry, "@")
+		if at < 0 {
+			return nil, errors.New(fmt.Sprintf("Self-test schedule %q has no time", entry))
+		}
+		schedule := SelfTestSchedule{}
+		name := strings.TrimSpace(entry[:at])
+		if i := strings.Index(name, ":"); i >= 0 {
+			schedule.Device, name = name[:i], name[i+1:]
+		}
+		test, ok := selfTestNames[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown self-test %s", name))
+		}
+		schedule.Test = test
+		spec, err := parseCronSpec(entry[at+1:])
+		if err != nil {
+			return nil, err
+		}
+		schedule.spec = spec
+		scheduler.Schedules = append(scheduler.Schedules, schedule)
+	}
+	return scheduler, nil
+}
+
+// Due returns self-test scheduled for device since it was checked last
+// time. The longest test is returned if more of them are due. Nothing is
+// due when device is checked for the first time.
+func (s *SelfTestScheduler) Due(device string, now time.Time) (byte, bool) {
+	last, ok := s.checked[device]
+	s.checked[device] = now
+	if !ok {
+		return 0, false
+	}
+	due := byte(0)
+	for _, schedule := range s.Schedules {
+		if schedule.Device != "" && schedule.Device != device {
+			continue
+		}
+		if selfTestPriority[schedule.Test] > selfTestPriority[due] &&
+			schedule.spec.matchesBetween(last, now) {
+			due = schedule.Test
+		}
+	}
+	return due, due != 0
+}
+
+// Started records that self-test was started on device.
+func (s *SelfTestScheduler) Started(device string, now time.Time) {
+	s.started[device] = now
+}
+
+// LastStarted returns when self-test was last started on device by
+// scheduler, zero time if never.
+func (s *SelfTestScheduler) LastStarted(device string) time.Time {
+	return s.started[device]
+}
+
+// Key of time when scheduled self-test was last started on device.
+var scheduledSelfTestKey = "selftest/scheduled/last_started"
+
+// GetAttributes returns time when self-test was last started on device by
+// scheduler, as Unix time. Nothing is returned if no test was started.
+func (s *SelfTestScheduler) GetAttributes(device string) map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	if started := s.LastStarted(device); !started.IsZero() {
+		ret_val[scheduledSelfTestKey] = started.Unix()
+	}
+	return ret_val
+}
@@ -0,0 +1,148 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCronSpec(t *testing.T) {
+	Convey("Parsing cron expression", t, func() {
+
+		spec, err := parseCronSpec("0,30 2-4 */10 * 1-5/2")
+
+		So(err, ShouldBeNil)
+		So(spec.minute, ShouldResemble, cronField{0: true, 30: true})
+		So(spec.hour, ShouldResemble, cronField{2: true, 3: true, 4: true})
+		So(spec.day, ShouldResemble, cronField{1: true, 11: true, 21: true, 31: true})
+		So(len(spec.month), ShouldEqual, 12)
+		So(spec.weekday, ShouldResemble, cronField{1: true, 3: true, 5: true})
+
+		Convey("Time matches when all fields match", func() {
+
+			// Wednesday
+			So(spec.matches(time.Date(2016, 8, 31, 3, 30, 0, 0, time.Local)), ShouldBeTrue)
+			So(spec.matches(time.Date(2016, 8, 31, 3, 31, 0, 0, time.Local)), ShouldBeFalse)
+			So(spec.matches(time.Date(2016, 8, 30, 3, 30, 0, 0, time.Local)), ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("Parsing cron expression with day of month and day of week", t, func() {
+
+		spec, err := parseCronSpec("0 0 1 * 7")
+
+		So(err, ShouldBeNil)
+		So(spec.weekday, ShouldResemble, cronField{0: true, 7: true})
+
+		Convey("Time matches when either of them matches", func() {
+
+			// Thursday, Sunday and Monday
+			So(spec.matches(time.Date(2016, 9, 1, 0, 0, 0, 0, time.Local)), ShouldBeTrue)
+			So(spec.matches(time.Date(2016, 9, 4, 0, 0, 0, 0, time.Local)), ShouldBeTrue)
+			So(spec.matches(time.Date(2016, 9, 5, 0, 0, 0, 0, time.Local)), ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("Parsing invalid cron expressions", t, func() {
+
+		for _, s := range []string{"* * * *", "60 * * * *", "* 5-2 * * *", "*/0 * * * *", "a * * * *", "* * * * 8"} {
+			_, err := parseCronSpec(s)
+			So(err, ShouldNotBeNil)
+		}
+
+	})
+}
+
+func TestSelfTestScheduler(t *testing.T) {
+	Convey("Parsing self-test schedules", t, func() {
+
+		scheduler, err := ParseSelfTestSchedules("short@0 * * * *; sda:long@30 2 * * *")
+
+		So(err, ShouldBeNil)
+		So(len(scheduler.Schedules), ShouldEqual, 2)
+		So(scheduler.Schedules[0].Device, ShouldEqual, "")
+		So(scheduler.Schedules[0].Test, ShouldEqual, selftest_short)
+		So(scheduler.Schedules[1].Device, ShouldEqual, "sda")
+		So(scheduler.Schedules[1].Test, ShouldEqual, selftest_extended)
+
+		start := time.Date(2016, 9, 1, 1, 50, 0, 0, time.Local)
+
+		Convey("Nothing is due when device is checked first time", func() {
+
+			_, due := scheduler.Due("sda", start)
+			So(due, ShouldBeFalse)
+
+		})
+
+		Convey("Test scheduled since last check is due", func() {
+
+			scheduler.Due("sdb", start)
+			_, due := scheduler.Due("sdb", start.Add(5*time.Minute))
+			So(due, ShouldBeFalse)
+			test, due := scheduler.Due("sdb", start.Add(15*time.Minute))
+			So(due, ShouldBeTrue)
+			So(test, ShouldEqual, selftest_short)
+			_, due = scheduler.Due("sdb", start.Add(20*time.Minute))
+			So(due, ShouldBeFalse)
+
+		})
+
+		Convey("The longest of due tests is chosen", func() {
+
+			scheduler.Due("sda", start)
+			test, due := scheduler.Due("sda", start.Add(time.Hour))
+			So(due, ShouldBeTrue)
+			So(test, ShouldEqual, selftest_extended)
+
+		})
+
+		Convey("Start of test is recorded", func() {
+
+			So(scheduler.LastStarted("sda").IsZero(), ShouldBeTrue)
+			So(scheduler.GetAttributes("sda"), ShouldBeEmpty)
+			scheduler.Started("sda", start)
+			So(scheduler.LastStarted("sda"), ShouldResemble, start)
+			So(scheduler.GetAttributes("sda"), ShouldResemble, map[string]interface{}{
+				"selftest/scheduled/last_started": start.Unix(),
+			})
+
+		})
+
+	})
+
+	Convey("Parsing invalid self-test schedules", t, func() {
+
+		for _, s := range []string{"short", "medium@* * * * *", "short@* * *"} {
+			_, err := ParseSelfTestSchedules(s)
+			So(err, ShouldNotBeNil)
+		}
+
+	})
+}
@@ -0,0 +1,347 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	scsi_log_sense               = 0x4d
+	scsi_log_cumulative_values   = 0x01 << 6
+	scsi_log_allocation_length   = 4096
+	scsi_log_page_header_length  = 4
+	scsi_log_param_header_length = 4
+
+	// Log pages
+	scsi_log_supported_pages          = 0x00
+	scsi_log_write_errors             = 0x02
+	scsi_log_read_errors              = 0x03
+	scsi_log_verify_errors            = 0x05
+	scsi_log_non_medium_errors        = 0x06
+	scsi_log_temperature              = 0x0d
+	scsi_log_start_stop_cycles        = 0x0e
+	scsi_log_informational_exceptions = 0x2f
+
+	// Temperature not available
+	scsi_temperature_invalid = 0xff
+)
+
+// Single parameter of log page.
+type ScsiLogParameter struct {
+	Code  uint16
+	Value []byte
+}
+
+// ScsiLogs holds parameters of log pages read from device, by page code.
+type ScsiLogs map[byte][]ScsiLogParameter
+
+// Describes log page supported by plugin. Decode returns values of page
+// parameters, keys of all values it can return are listed in Keys.
+type scsiLogPage struct {
+	Code   byte
+	Decode func(params []ScsiLogParameter) map[string]interface{}
+	Keys   []string
+}
+
+// Names of parameters of write, read and verify error counter pages.
+var scsiErrorCounters = map[uint16]string{
+	0x0000: "correctedfast",
+	0x0001: "correcteddelayed",
+	0x0002: "retries",
+	0x0003: "corrected",
+	0x0004: "algorithminvocations",
+	0x0005: "bytesprocessed",
+	0x0006: "uncorrected",
+}
+
+// Names of parameters of start-stop cycle counter page.
+var scsiStartStopCounters = map[uint16]string{
+	0x0003: "startstop/specified",
+	0x0004: "startstop/accumulated",
+	0x0005: "loadunload/specified",
+	0x0006: "loadunload/accumulated",
+}
+
+// Log pages read from SCSI devices.
+var scsiLogPages = []scsiLogPage{
+	errorCounterPage(scsi_log_write_errors, "errors/write/"),
+	errorCounterPage(scsi_log_read_errors, "errors/read/"),
+	errorCounterPage(scsi_log_verify_errors, "errors/verify/"),
+	{
+		Code:   scsi_log_non_medium_errors,
+		Decode: decodeNonMediumErrors,
+		Keys:   []string{"errors/nonmedium"},
+	},
+	{
+		Code:   scsi_log_temperature,
+		Decode: decodeTemperature,
+		Keys:   []string{"temperature", "temperature/reference"},
+	},
+	{
+		Code:   scsi_log_start_stop_cycles,
+		Decode: decodeStartStopCycles,
+		Keys:   mapValues(scsiStartStopCounters),
+	},
+	{
+		Code:   scsi_log_informational_exceptions,
+		Decode: decodeInformationalExceptions,
+		Keys: []string{"informationalexceptions/asc",
+			"informationalexceptions/ascq",
+			"informationalexceptions/temperature"},
+	},
+}
+
+func mapValues(m map[uint16]string) []string {
+	ret := []string{}
+	for _, v := range m {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// scsiCounter decodes big endian counter of variable length.
+func scsiCounter(value []byte) uint64 {
+	ret := uint64(0)
+	for _, b := range value {
+		ret = ret<<8 + uint64(b)
+	}
+	return ret
+}
+
+func errorCounterPage(code byte, prefix string) scsiLogPage {
+	keys := []string{}
+	for _, v := range scsiErrorCounters {
+		keys = append(keys, prefix+v)
+	}
+	return scsiLogPage{
+		Code: code,
+		Decode: func(params []ScsiLogParameter) map[string]interface{} {
+			ret := map[string]interface{}{}
+			for _, p := range params {
+				if name, ok := scsiErrorCounters[p.Code]; ok {
+					ret[prefix+name] = scsiCounter(p.Value)
+				}
+			}
+			return ret
+		},
+		Keys: keys,
+	}
+}
+
+func decodeNonMediumErrors(params []ScsiLogParameter) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, p := range params {
+		if p.Code == 0x0000 {
+			ret["errors/nonmedium"] = scsiCounter(p.Value)
+		}
+	}
+	return ret
+}
+
+func decodeTemperature(params []ScsiLogParameter) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, p := range params {
+		if len(p.Value) < 2 || p.Value[1] == scsi_temperature_invalid {
+			continue
+		}
+		switch p.Code {
+		case 0x0000:
+			ret["temperature"] = uint64(p.Value[1])
+		case 0x0001:
+			ret["temperature/reference"] = uint64(p.Value[1])
+		}
+	}
+	return ret
+}
+
+func decodeStartStopCycles(params []ScsiLogParameter) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, p := range params {
+		if name, ok := scsiStartStopCounters[p.Code]; ok {
+			ret[name] = scsiCounter(p.Value)
+		}
+	}
+	return ret
+}
+
+func decodeInformationalExceptions(params []ScsiLogParameter) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, p := range params {
+		if p.Code != 0x0000 || len(p.Value) < 2 {
+			continue
+		}
+		ret["informationalexceptions/asc"] = p.Value[0]
+		ret["informationalexceptions/ascq"] = p.Value[1]
+		if len(p.Value) > 2 && p.Value[2] != scsi_temperature_invalid {
+			ret["informationalexceptions/temperature"] = uint64(p.Value[2])
+		}
+	}
+	return ret
+}
+
+// ParseScsiLogPage splits log page into parameters.
+// It returns page code and list of parameters.
+func ParseScsiLogPage(data []byte) (byte, []ScsiLogParameter, error) {
+	if len(data) < scsi_log_page_header_length {
+		return 0, nil, errors.New("Log page too short")
+	}
+
+	end := scsi_log_page_header_length + int(binary.BigEndian.Uint16(data[2:4]))
+	if end > len(data) {
+		end = len(data)
+	}
+
+	params := []ScsiLogParameter{}
+	for i := scsi_log_page_header_length; i+scsi_log_param_header_length <= end; {
+		length := int(data[i+3])
+		next := i + scsi_log_param_header_length + length
+		if next > end {
+			break
+		}
+		params = append(params, ScsiLogParameter{
+			Code:  binary.BigEndian.Uint16(data[i : i+2]),
+			Value: data[i+scsi_log_param_header_length : next],
+		})
+		i = next
+	}
+
+	return data[0] & 0x3f, params, nil
+}
+
+// ParseScsiSupportedPages decodes supported log pages page, which lists
+// page codes instead of parameters.
+func ParseScsiSupportedPages(data []byte) map[byte]bool {
+	pages := map[byte]bool{}
+	if len(data) < scsi_log_page_header_length {
+		return pages
+	}
+
+	end := scsi_log_page_header_length + int(binary.BigEndian.Uint16(data[2:4]))
+	if end > len(data) {
+		end = len(data)
+	}
+	for _, code := range data[scsi_log_page_header_length:end] {
+		pages[code&0x3f] = true
+	}
+
+	return pages
+}
+
+func readScsiLogPage(fd uintptr, code byte, sysutilProvider SysutilProvider) ([]byte, error) {
+	cdb := make([]byte, 10)
+	cdb[0] = scsi_log_sense
+	cdb[2] = scsi_log_cumulative_values | code
+	binary.BigEndian.PutUint16(cdb[7:9], scsi_log_allocation_length)
+
+	cmd := ScsiCommand{
+		Cdb:   cdb,
+		Data:  make([]byte, scsi_log_allocation_length),
+		Sense: make([]byte, 32),
+	}
+	if err := sysutilProvider.SgIo(fd, &cmd); err != nil {
+		return nil, err
+	}
+	if cmd.Status != scsi_status_good {
+		return nil, scsiStatusError("LOG SENSE", cmd.Status, cmd.Sense)
+	}
+
+	return cmd.Data, nil
+}
+
+// ReadScsiLogs_ retrieves log pages supported by both device and plugin.
+// It fails when device does not report list of supported pages.
+func ReadScsiLogs_(device string, sysutilProvider SysutilProvider) (ScsiLogs, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	data, err := readScsiLogPage(f.Fd(), scsi_log_supported_pages, sysutilProvider)
+	if err != nil {
+		return nil, readError(device, "SCSI log pages reading", err)
+	}
+	pages := ParseScsiSupportedPages(data)
+
+	logs := ScsiLogs{}
+	for _, page := range scsiLogPages {
+		if !pages[page.Code] {
+			continue
+		}
+		data, err := readScsiLogPage(f.Fd(), page.Code, sysutilProvider)
+		if err != nil {
+			return nil, readError(device, fmt.Sprintf("SCSI log page %#x reading", page.Code), err)
+		}
+		code, params, err := ParseScsiLogPage(data)
+		if err != nil || code != page.Code {
+			continue
+		}
+		logs[code] = params
+	}
+
+	return logs, nil
+}
+
+// Introduced to make mocking possible. See ReadScsiLogs_.
+var ReadScsiLogs = ReadScsiLogs_
+
+// Passed tells whether device reports no informational exception. The
+// second value is false if informational exceptions page was not read,
+// so health of device is unknown.
+func (l ScsiLogs) Passed() (bool, bool) {
+	for _, p := range l[scsi_log_informational_exceptions] {
+		if p.Code == 0x0000 && len(p.Value) > 0 {
+			return p.Value[0] == 0, true
+		}
+	}
+	return false, false
+}
+
+// GetAttributes transforms log pages to map containing their values.
+// Values are accessed using "scsi/[label]".
+func (l ScsiLogs) GetAttributes() map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	for _, page := range scsiLogPages {
+		params, ok := l[page.Code]
+		if !ok {
+			continue
+		}
+		for k, v := range page.Decode(params) {
+			ret_val["scsi/"+k] = v
+		}
+	}
+	return ret_val
+}
+
+// Returns list of keys that can be used to access values of all log pages.
+func listScsiKeys() []string {
+	keys := []string{}
+	for _, page := range scsiLogPages {
+		for _, k := range page.Keys {
+			keys = append(keys, "scsi/"+k)
+		}
+	}
+	return keys
+}
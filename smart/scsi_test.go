@@ -0,0 +1,286 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeScsiProvider struct {
+	fakeSysutilProvider
+
+	AskedPages []byte
+	Pages      map[byte][]byte
+}
+
+func (s *fakeScsiProvider) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	code := cmd.Cdb[2] & 0x3f
+	s.AskedPages = append(s.AskedPages, code)
+
+	page, ok := s.Pages[code]
+	if !ok {
+		cmd.Status = scsi_status_check_condition
+		cmd.Sense = cmd.Sense[:copy(cmd.Sense, []byte{0x70, 0, 0x05})]
+		return nil
+	}
+	copy(cmd.Data, page)
+
+	return nil
+}
+
+func logParam(code uint16, value ...byte) []byte {
+	return append([]byte{byte(code >> 8), byte(code), 0x03, byte(len(value))}, value...)
+}
+
+func logPage(code byte, params ...[]byte) []byte {
+	page := []byte{code, 0, 0, 0}
+	for _, p := range params {
+		page = append(page, p...)
+	}
+	length := len(page) - 4
+	page[2], page[3] = byte(length>>8), byte(length)
+	return page
+}
+
+var temperaturePageFixture = logPage(scsi_log_temperature,
+	logParam(0x0000, 0x00, 0x23),
+	logParam(0x0001, 0x00, 0x41),
+)
+
+var startStopPageFixture = logPage(scsi_log_start_stop_cycles,
+	logParam(0x0001, '2', '0', '1', '7', '0', '3'),
+	logParam(0x0002, ' ', ' ', ' ', ' ', ' ', ' '),
+	logParam(0x0003, 0x00, 0x00, 0xc3, 0x50),
+	logParam(0x0004, 0x00, 0x00, 0x01, 0x23),
+	logParam(0x0005, 0x00, 0x09, 0x27, 0xc0),
+	logParam(0x0006, 0x00, 0x00, 0x04, 0xd2),
+)
+
+func errorCounterPageFixture(code byte) []byte {
+	return logPage(code,
+		logParam(0x0000, 0x00, 0x00, 0x00, 0x10),
+		logParam(0x0001, 0x00, 0x00, 0x00, 0x00),
+		logParam(0x0002, 0x00, 0x00, 0x00, 0x02),
+		logParam(0x0003, 0x00, 0x00, 0x00, 0x10),
+		logParam(0x0004, 0x00, 0x00, 0x00, 0x11),
+		logParam(0x0005, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x78, 0x90),
+		logParam(0x0006, 0x00, 0x00, 0x00, 0x01),
+	)
+}
+
+var nonMediumPageFixture = logPage(scsi_log_non_medium_errors,
+	logParam(0x0000, 0x00, 0x07),
+)
+
+var informationalExceptionsPageFixture = logPage(scsi_log_informational_exceptions,
+	logParam(0x0000, 0x5d, 0x10, 0x28, 0x41),
+)
+
+var supportedPagesFixture = []byte{scsi_log_supported_pages, 0, 0, 7,
+	0x00, 0x03, 0x06, 0x0d, 0x0e, 0x2f, 0x30}
+
+func decodedPage(code byte, page []byte) map[string]interface{} {
+	parsedCode, params, err := ParseScsiLogPage(page)
+	So(err, ShouldBeNil)
+	So(parsedCode, ShouldEqual, code)
+	return ScsiLogs{code: params}.GetAttributes()
+}
+
+func TestScsiLogPages(t *testing.T) {
+	Convey("Decoding temperature page", t, func() {
+
+		attrs := decodedPage(scsi_log_temperature, temperaturePageFixture)
+
+		So(attrs["scsi/temperature"], ShouldEqual, 35)
+		So(attrs["scsi/temperature/reference"], ShouldEqual, 65)
+
+		Convey("Unavailable temperature should be skipped", func() {
+
+			attrs := decodedPage(scsi_log_temperature, logPage(scsi_log_temperature,
+				logParam(0x0000, 0x00, 0xff)))
+			So(attrs, ShouldBeEmpty)
+
+		})
+
+	})
+
+	Convey("Decoding start-stop cycle counter page", t, func() {
+
+		attrs := decodedPage(scsi_log_start_stop_cycles, startStopPageFixture)
+
+		So(len(attrs), ShouldEqual, 4)
+		So(attrs["scsi/startstop/specified"], ShouldEqual, 50000)
+		So(attrs["scsi/startstop/accumulated"], ShouldEqual, 291)
+		So(attrs["scsi/loadunload/specified"], ShouldEqual, 600000)
+		So(attrs["scsi/loadunload/accumulated"], ShouldEqual, 1234)
+
+	})
+
+	for code, name := range map[byte]string{
+		scsi_log_write_errors:  "write",
+		scsi_log_read_errors:   "read",
+		scsi_log_verify_errors: "verify",
+	} {
+		Convey("Decoding "+name+" error counter page", t, func() {
+
+			attrs := decodedPage(code, errorCounterPageFixture(code))
+			prefix := "scsi/errors/" + name + "/"
+
+			So(len(attrs), ShouldEqual, 7)
+			So(attrs[prefix+"correctedfast"], ShouldEqual, 0x10)
+			So(attrs[prefix+"correcteddelayed"], ShouldEqual, 0)
+			So(attrs[prefix+"retries"], ShouldEqual, 2)
+			So(attrs[prefix+"corrected"], ShouldEqual, 0x10)
+			So(attrs[prefix+"algorithminvocations"], ShouldEqual, 0x11)
+			So(attrs[prefix+"bytesprocessed"], ShouldEqual, uint64(0x1234567890))
+			So(attrs[prefix+"uncorrected"], ShouldEqual, 1)
+
+		})
+	}
+
+	Convey("Decoding non-medium error page", t, func() {
+
+		attrs := decodedPage(scsi_log_non_medium_errors, nonMediumPageFixture)
+
+		So(attrs, ShouldResemble, map[string]interface{}{"scsi/errors/nonmedium": uint64(7)})
+
+	})
+
+	Convey("Decoding informational exceptions page", t, func() {
+
+		_, params, _ := ParseScsiLogPage(informationalExceptionsPageFixture)
+		logs := ScsiLogs{scsi_log_informational_exceptions: params}
+		attrs := logs.GetAttributes()
+
+		So(attrs["scsi/informationalexceptions/asc"], ShouldEqual, 0x5d)
+		So(attrs["scsi/informationalexceptions/ascq"], ShouldEqual, 0x10)
+		So(attrs["scsi/informationalexceptions/temperature"], ShouldEqual, 40)
+
+		Convey("Device should be reported as failing", func() {
+
+			passed, ok := logs.Passed()
+			So(ok, ShouldBeTrue)
+			So(passed, ShouldBeFalse)
+
+		})
+
+		Convey("Health of device without the page should be unknown", func() {
+
+			_, ok := ScsiLogs{}.Passed()
+			So(ok, ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("Decoding truncated page", t, func() {
+
+		page := temperaturePageFixture[:len(temperaturePageFixture)-1]
+		_, params, err := ParseScsiLogPage(page)
+
+		Convey("Should skip incomplete parameter", func() {
+
+			So(err, ShouldBeNil)
+			So(len(params), ShouldEqual, 1)
+
+		})
+
+		Convey("Should fail on missing header", func() {
+
+			_, _, err := ParseScsiLogPage(page[:3])
+			So(err, ShouldNotBeNil)
+
+		})
+
+	})
+
+	Convey("Keys and output of decoding are consistent", t, func() {
+
+		keys := listScsiKeys()
+		for _, page := range scsiLogPages {
+			for key := range page.Decode([]ScsiLogParameter{}) {
+				So(keys, ShouldContain, "scsi/"+key)
+			}
+		}
+		logs := ScsiLogs{}
+		for code, page := range map[byte][]byte{
+			scsi_log_temperature:              temperaturePageFixture,
+			scsi_log_start_stop_cycles:        startStopPageFixture,
+			scsi_log_write_errors:             errorCounterPageFixture(scsi_log_write_errors),
+			scsi_log_read_errors:              errorCounterPageFixture(scsi_log_read_errors),
+			scsi_log_verify_errors:            errorCounterPageFixture(scsi_log_verify_errors),
+			scsi_log_non_medium_errors:        nonMediumPageFixture,
+			scsi_log_informational_exceptions: informationalExceptionsPageFixture,
+		} {
+			_, logs[code], _ = ParseScsiLogPage(page)
+		}
+		attrs := logs.GetAttributes()
+		So(len(attrs), ShouldEqual, len(keys))
+		for _, key := range keys {
+			So(attrs, ShouldContainKey, key)
+		}
+
+	})
+}
+
+func TestReadScsiLogs(t *testing.T) {
+	Convey("Reading log pages from SCSI device", t, func() {
+
+		provider := &fakeScsiProvider{Pages: map[byte][]byte{
+			scsi_log_supported_pages:          supportedPagesFixture,
+			scsi_log_read_errors:              errorCounterPageFixture(scsi_log_read_errors),
+			scsi_log_non_medium_errors:        nonMediumPageFixture,
+			scsi_log_temperature:              temperaturePageFixture,
+			scsi_log_start_stop_cycles:        startStopPageFixture,
+			scsi_log_informational_exceptions: informationalExceptionsPageFixture,
+		}}
+		logs, err := ReadScsiLogs("MYDEV", provider)
+
+		Convey("Should read only pages supported by both device and plugin", func() {
+
+			So(err, ShouldBeNil)
+			So(provider.AskedPages, ShouldResemble, []byte{scsi_log_supported_pages,
+				scsi_log_read_errors, scsi_log_non_medium_errors, scsi_log_temperature,
+				scsi_log_start_stop_cycles, scsi_log_informational_exceptions})
+			So(len(logs), ShouldEqual, 5)
+
+		})
+
+	})
+
+	Convey("When device does not support log pages", t, func() {
+
+		provider := &fakeScsiProvider{Pages: map[byte][]byte{}}
+		_, err := ReadScsiLogs("MYDEV", provider)
+
+		Convey("Should report error", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "sense key = 0x5")
+
+		})
+
+	})
+}
@@ -0,0 +1,181 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Log addresses
+	sct_command_status_log = 0xe0
+	sct_data_transfer_log  = 0xe1
+
+	// SCT Data Table command reading HDA temperature history table
+	sct_action_data_table   = 0x0005
+	sct_function_read_table = 0x0001
+	sct_table_temperature   = 0x0002
+
+	// Offsets of temperatures in SCT Status
+	sct_status_temperature       = 200
+	sct_status_over_limit_count  = 206
+	sct_status_under_limit_count = 210
+
+	// Offsets in temperature history table
+	sct_history_interval = 4
+	sct_history_limits   = 6
+	sct_history_size     = 30
+	sct_history_index    = 32
+	sct_history_entries  = 34
+
+	// Maximal number of temperature history entries fitting in sector
+	sct_history_max_entries = 512 - sct_history_entries
+
+	// Temperature not available
+	sct_temperature_invalid = -128
+)
+
+// SctTemperatures holds temperatures reported in SCT Status and, if device
+// supports it, temperature history table. History holds sampled
+// temperatures, the most recent first, invalid values are omitted.
+type SctTemperatures struct {
+	Status  []byte
+	History []byte
+}
+
+// Keys of temperatures in SCT Status, by offset.
+var sctStatusTemperatures = map[int]string{
+	sct_status_temperature:     "sct/temperature/current",
+	sct_status_temperature + 1: "sct/temperature/powercycle/min",
+	sct_status_temperature + 2: "sct/temperature/powercycle/max",
+	sct_status_temperature + 3: "sct/temperature/lifetime/min",
+	sct_status_temperature + 4: "sct/temperature/lifetime/max",
+}
+
+// Keys of temperature limits in temperature history table, by offset.
+var sctHistoryLimits = map[int]string{
+	sct_history_limits:     "sct/temperature/recommended/max",
+	sct_history_limits + 1: "sct/temperature/limit/max",
+	sct_history_limits + 2: "sct/temperature/recommended/min",
+	sct_history_limits + 3: "sct/temperature/limit/min",
+}
+
+// Keys of limit violation counters in SCT Status.
+var sctLimitCounters = map[int]string{
+	sct_status_over_limit_count:  "sct/temperature/overlimitcount",
+	sct_status_under_limit_count: "sct/temperature/underlimitcount",
+}
+
+// Key of interval between temperature history samples, in minutes.
+var sctHistoryIntervalKey = "sct/temperature/historyinterval"
+
+func sctHistoryKey(i int) string {
+	return fmt.Sprintf("sct/temperature/history/%03d", i)
+}
+
+// ReadSctTemperatures_ retrieves SCT Status and temperature history table,
+// which is read using SCT Data Table command. Failure of reading history
+// is not reported, it is omitted then.
+func ReadSctTemperatures_(device string, sysutilProvider SysutilProvider) (*SctTemperatures, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	transport := NewAtaTransport(sysutilProvider, device)
+	status, err := readSmartLog(f.Fd(), transport, sct_command_status_log, 1)
+	if err != nil {
+		return nil, readError(device, "SCT status reading", err)
+	}
+	temperatures := &SctTemperatures{Status: status}
+
+	cmd := make([]byte, 512)
+	binary.LittleEndian.PutUint16(cmd[0:2], sct_action_data_table)
+	binary.LittleEndian.PutUint16(cmd[2:4], sct_function_read_table)
+	binary.LittleEndian.PutUint16(cmd[4:6], sct_table_temperature)
+	if err := writeSmartLog(f.Fd(), transport, sct_command_status_log, cmd); err != nil {
+		return temperatures, nil
+	}
+	if history, err := readSmartLog(f.Fd(), transport, sct_data_transfer_log, 1); err == nil {
+		temperatures.History = history
+	}
+
+	return temperatures, nil
+}
+
+// Introduced to make mocking possible. See ReadSctTemperatures_.
+var ReadSctTemperatures = ReadSctTemperatures_
+
+// GetAttributes transforms SCT Status and temperature history to map
+// containing temperatures in Celsius. History samples are accessed using
+// "sct/temperature/history/[NNN]", where 000 is the most recent one.
+func (t SctTemperatures) GetAttributes() map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	temperature := func(key string, value byte) {
+		if int8(value) != sct_temperature_invalid {
+			ret_val[key] = int64(int8(value))
+		}
+	}
+
+	if len(t.Status) >= 512 {
+		for offset, key := range sctStatusTemperatures {
+			temperature(key, t.Status[offset])
+		}
+		for offset, key := range sctLimitCounters {
+			ret_val[key] = uint64(binary.LittleEndian.Uint32(t.Status[offset : offset+4]))
+		}
+	}
+
+	if len(t.History) >= 512 {
+		for offset, key := range sctHistoryLimits {
+			temperature(key, t.History[offset])
+		}
+		ret_val[sctHistoryIntervalKey] = uint64(binary.LittleEndian.Uint16(t.History[sct_history_interval:]))
+		size := int(binary.LittleEndian.Uint16(t.History[sct_history_size:]))
+		index := int(binary.LittleEndian.Uint16(t.History[sct_history_index:]))
+		if size > sct_history_max_entries {
+			size = sct_history_max_entries
+		}
+		// History is circular buffer, index points to the most recent entry
+		for n := 0; n < size && index < size; n++ {
+			i := (index - n + size) % size
+			temperature(sctHistoryKey(n), t.History[sct_history_entries+i])
+		}
+	}
+
+	return ret_val
+}
+
+// Returns list of keys that can be used to access SCT temperatures.
+// Number of history sample is dynamic element.
+func listSctKeys() []string {
+	keys := []string{sctHistoryIntervalKey}
+	for _, m := range []map[int]string{sctStatusTemperatures, sctHistoryLimits, sctLimitCounters} {
+		for _, k := range m {
+			keys = append(keys, k)
+		}
+	}
+	keys = append(keys, "sct/temperature/history/"+dynamicElement(sampleElement))
+	return keys
+}
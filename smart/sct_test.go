@@ -0,0 +1,149 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// SCT Status with current temperature 35, power cycle 30-40, lifetime
+// minimum unknown and maximum 55, and one over limit event.
+func sctStatusFixture() []byte {
+	data := make([]byte, 512)
+	binary.LittleEndian.PutUint16(data[0:2], 3)
+	copy(data[sct_status_temperature:], []byte{35, 30, 40, 0x80, 55})
+	binary.LittleEndian.PutUint32(data[sct_status_over_limit_count:], 1)
+	return data
+}
+
+// Temperature history of 4 entries sampled every 10 minutes, the most
+// recent one at index 1, and the oldest one not valid.
+func sctHistoryFixture() []byte {
+	data := make([]byte, 512)
+	binary.LittleEndian.PutUint16(data[0:2], 2)
+	binary.LittleEndian.PutUint16(data[2:4], 1)
+	binary.LittleEndian.PutUint16(data[sct_history_interval:], 10)
+	copy(data[sct_history_limits:], []byte{60, 70, 0, 0xfb})
+	binary.LittleEndian.PutUint16(data[sct_history_size:], 4)
+	binary.LittleEndian.PutUint16(data[sct_history_index:], 1)
+	copy(data[sct_history_entries:], []byte{33, 34, 0x80, 32})
+	return data
+}
+
+func TestSctTemperatures(t *testing.T) {
+	Convey("Decoding SCT Status and temperature history", t, func() {
+
+		temps := SctTemperatures{Status: sctStatusFixture(), History: sctHistoryFixture()}
+
+		So(temps.GetAttributes(), ShouldResemble, map[string]interface{}{
+			"sct/temperature/current":         int64(35),
+			"sct/temperature/powercycle/min":  int64(30),
+			"sct/temperature/powercycle/max":  int64(40),
+			"sct/temperature/lifetime/max":    int64(55),
+			"sct/temperature/overlimitcount":  uint64(1),
+			"sct/temperature/underlimitcount": uint64(0),
+			"sct/temperature/recommended/max": int64(60),
+			"sct/temperature/limit/max":       int64(70),
+			"sct/temperature/recommended/min": int64(0),
+			"sct/temperature/limit/min":       int64(-5),
+			"sct/temperature/historyinterval": uint64(10),
+			"sct/temperature/history/000":     int64(34),
+			"sct/temperature/history/001":     int64(33),
+			"sct/temperature/history/002":     int64(32),
+		})
+
+	})
+
+	Convey("Decoding SCT Status without temperature history", t, func() {
+
+		attrs := SctTemperatures{Status: sctStatusFixture()}.GetAttributes()
+
+		So(attrs["sct/temperature/current"], ShouldEqual, 35)
+		So(attrs, ShouldNotContainKey, "sct/temperature/historyinterval")
+
+	})
+
+	Convey("SCT temperatures are advertised", t, func() {
+
+		So(ListAllKeys(), ShouldContain, "sct/temperature/lifetime/min")
+		So(ListAllKeys(), ShouldContain, "sct/temperature/history/[sample]")
+		So(ListAllKeys(), ShouldNotContain, "sct/temperature/history/477")
+
+	})
+}
+
+func TestReadSctTemperatures(t *testing.T) {
+	Convey("Reading SCT temperatures", t, func() {
+
+		provider := &fakeLogProvider{
+			fakeSysutilProvider: fakeSysutilProvider{IoctlRets: []error{errors.New("EINVAL")}},
+			Logs: map[byte][]byte{
+				sct_command_status_log: sctStatusFixture(),
+				sct_data_transfer_log:  sctHistoryFixture(),
+			},
+		}
+		temps, err := ReadSctTemperatures("MYDEV", provider)
+
+		Convey("Should read status and history", func() {
+
+			So(err, ShouldBeNil)
+			So(temps.Status, ShouldResemble, sctStatusFixture())
+			So(temps.History, ShouldResemble, sctHistoryFixture())
+
+		})
+
+		Convey("Should request history table using SMART WRITE LOG", func() {
+
+			So(len(provider.LogArgs), ShouldEqual, 3)
+			cmd := provider.LogArgs[1]
+			So(cmd.DataOut, ShouldBeTrue)
+			So(cmd.Cdb[1], ShouldEqual, sat_protocol_pio_out<<1)
+			So(cmd.Cdb[4], ShouldEqual, smart_write_log)
+			So(binary.LittleEndian.Uint16(cmd.Data[0:2]), ShouldEqual, sct_action_data_table)
+			So(binary.LittleEndian.Uint16(cmd.Data[4:6]), ShouldEqual, sct_table_temperature)
+
+		})
+
+	})
+
+	Convey("Reading SCT temperatures using HDIO ioctls", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, sct_command_status_log, smart_read_log, 1}, sctStatusFixture()...)}
+		temps, err := ReadSctTemperatures("MYDEV", provider)
+
+		Convey("History is omitted when it cannot be read", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(temps.History, ShouldBeNil)
+
+		})
+
+	})
+}
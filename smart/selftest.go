@@ -0,0 +1,263 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// Log addresses
+	smart_selftest_log = 0x06
+	ext_selftest_log   = 0x07
+
+	selftest_log_entries            = 21
+	selftest_entry_length           = 24
+	selftest_index_offset           = 508
+	ext_selftest_entries_per_page   = 19
+	ext_selftest_entry_length       = 26
+	ext_selftest_descriptors_offset = 4
+
+	// Values of self-test execution status
+	selftest_status_fatal           = 0x3
+	selftest_status_handling_damage = 0x8
+	selftest_status_in_progress     = 0xf
+)
+
+// SelfTestEntry describes single self-test logged by device.
+// Type is number of test (content of LBA low register when test was
+// started), Status is self-test execution status and Hours is device
+// lifetime in power-on hours when test completed.
+type SelfTestEntry struct {
+	Type       byte
+	Status     byte
+	Remaining  byte
+	Hours      uint16
+	FailingLba uint64
+}
+
+// Failed tells whether test completed with failure of the device.
+func (e SelfTestEntry) Failed() bool {
+	return e.Status >= selftest_status_fatal && e.Status <= selftest_status_handling_damage
+}
+
+// SelfTestLog holds entries of self-test log, the most recent first.
+type SelfTestLog struct {
+	Entries []SelfTestEntry
+}
+
+// Keys of values describing self-test in progress, see SelfTestInProgress.
+var selfTestProgressKeys = []string{"selftest/in_progress", "selftest/remaining_percent"}
+
+// Keys of values published for self-test log, see SelfTestLog.GetAttributes.
+var selfTestKeys = []string{
+	"selftest/last/type",
+	"selftest/last/status",
+	"selftest/last/remaining_percent",
+	"selftest/last/hours",
+	"selftest/last/failinglba",
+	"selftest/failed",
+}
+
+// decodeSelfTestStatus splits self-test execution status byte into status
+// and percent of test remaining.
+func decodeSelfTestStatus(status byte) (byte, byte) {
+	return status >> 4, (status & 0x0f) * 10
+}
+
+// ParseSelfTestLog decodes SMART self-test log, which is circular buffer
+// of 21 entries with 28-bit failing LBA.
+func ParseSelfTestLog(data []byte) (*SelfTestLog, error) {
+	if len(data) < 512 {
+		return nil, errors.New("Self-test log too short")
+	}
+
+	log := &SelfTestLog{}
+	index := int(data[selftest_index_offset])
+	if index == 0 || index > selftest_log_entries {
+		return log, nil
+	}
+	for n := 0; n < selftest_log_entries; n++ {
+		i := (index - 1 - n + selftest_log_entries) % selftest_log_entries
+		d := data[2+i*selftest_entry_length : 2+(i+1)*selftest_entry_length]
+		if d[0] == 0 {
+			break
+		}
+		e := SelfTestEntry{
+			Type:       d[0],
+			Hours:      binary.LittleEndian.Uint16(d[2:4]),
+			FailingLba: uint64(binary.LittleEndian.Uint32(d[5:9])),
+		}
+		e.Status, e.Remaining = decodeSelfTestStatus(d[1])
+		log.Entries = append(log.Entries, e)
+	}
+
+	return log, nil
+}
+
+// ParseExtSelfTestLog decodes all pages of extended self-test log, which
+// is circular buffer of 19 entries per page with 48-bit failing LBA.
+func ParseExtSelfTestLog(data []byte) (*SelfTestLog, error) {
+	if len(data) < 512 {
+		return nil, errors.New("Extended self-test log too short")
+	}
+
+	log := &SelfTestLog{}
+	entries := len(data) / 512 * ext_selftest_entries_per_page
+	index := int(binary.LittleEndian.Uint16(data[2:4]))
+	if index == 0 || index > entries {
+		return log, nil
+	}
+	for n := 0; n < entries; n++ {
+		i := (index - 1 - n + entries) % entries
+		offset := i/ext_selftest_entries_per_page*512 + ext_selftest_descriptors_offset +
+			i%ext_selftest_entries_per_page*ext_selftest_entry_length
+		d := data[offset : offset+ext_selftest_entry_length]
+		if d[0] == 0 {
+			break
+		}
+		e := SelfTestEntry{
+			Type:  d[0],
+			Hours: binary.LittleEndian.Uint16(d[2:4]),
+			FailingLba: uint64(d[5]) + uint64(d[6])<<8 + uint64(d[7])<<16 +
+				uint64(d[8])<<24 + uint64(d[9])<<32 + uint64(d[10])<<40,
+		}
+		e.Status, e.Remaining = decodeSelfTestStatus(d[1])
+		log.Entries = append(log.Entries, e)
+	}
+
+	return log, nil
+}
+
+// readExtSelfTestLog reads all pages of extended self-test log, their
+// number is given in General Purpose Log Directory.
+func readExtSelfTestLog(fd uintptr, transport AtaTransport) (*SelfTestLog, error) {
+	pages, err := readGplLogPages(fd, transport, ext_selftest_log)
+	if err != nil {
+		return nil, err
+	}
+	if pages == 0 {
+		return nil, unsupportedError("Extended self-test log not supported")
+	}
+	if pages > 255 {
+		pages = 255
+	}
+	data, err := readLogExt(fd, transport, ext_selftest_log, 0, pages)
+	if err != nil {
+		return nil, err
+	}
+	return ParseExtSelfTestLog(data)
+}
+
+// ReadSelfTestLog_ retrieves extended self-test log from device, or SMART
+// self-test log if device does not support the former.
+func ReadSelfTestLog_(device string, sysutilProvider SysutilProvider) (*SelfTestLog, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
+	}
+	defer f.Close()
+
+	transport := NewAtaTransport(sysutilProvider, device)
+	if log, err := readExtSelfTestLog(f.Fd(), transport); err == nil {
+		return log, nil
+	}
+
+	data, err := readSmartLog(f.Fd(), transport, smart_selftest_log, 1)
+	if err != nil {
+		return nil, readError(device, "S.M.A.R.T self-test log reading", err)
+	}
+	return ParseSelfTestLog(data)
+}
+
+// Introduced to make mocking possible. See ReadSelfTestLog_.
+var ReadSelfTestLog = ReadSelfTestLog_
+
+// GetAttributes transforms self-test log to map containing values
+// describing the most recent test and number of failed tests in the log.
+// Failing LBA is present only if the most recent test failed.
+func (l SelfTestLog) GetAttributes() map[string]interface{} {
+	failed := uint64(0)
+	for _, e := range l.Entries {
+		if e.Failed() {
+			failed++
+		}
+	}
+	ret_val := map[string]interface{}{"selftest/failed": failed}
+	if len(l.Entries) == 0 {
+		return ret_val
+	}
+
+	last := l.Entries[0]
+	ret_val["selftest/last/type"] = uint64(last.Type)
+	ret_val["selftest/last/status"] = uint64(last.Status)
+	ret_val["selftest/last/remaining_percent"] = uint64(last.Remaining)
+	ret_val["selftest/last/hours"] = uint64(last.Hours)
+	if last.Failed() {
+		ret_val["selftest/last/failinglba"] = last.FailingLba
+	}
+	return ret_val
+}
+
+// SelfTestInProgress tells whether device executes self-test, according to
+// self-test execution status in smart data.
+func (sv SmartValues) SelfTestInProgress() bool {
+	status, _ := decodeSelfTestStatus(sv.SelfTestStatus)
+	return status == selftest_status_in_progress
+}
+
+// GetSelfTestProgress returns values describing self-test in progress.
+// Values are accessed using "selftest/in_progress" and
+// "selftest/remaining_percent", which is 0 if no test is in progress.
+func (sv SmartValues) GetSelfTestProgress() map[string]interface{} {
+	_, remaining := decodeSelfTestStatus(sv.SelfTestStatus)
+	if !sv.SelfTestInProgress() {
+		remaining = 0
+	}
+	return map[string]interface{}{
+		"selftest/in_progress":       sv.SelfTestInProgress(),
+		"selftest/remaining_percent": uint64(remaining),
+	}
+}
+
+// ExecuteSelfTest_ starts self-test with given number in off-line mode,
+// using SMART EXECUTE OFF-LINE IMMEDIATE. Device keeps processing commands
+// while test runs.
+func ExecuteSelfTest_(device string, test byte, sysutilProvider SysutilProvider) error {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return openError(device)
+	}
+	defer f.Close()
+
+	cmd := smartCommand(smart_execute_offline)
+	cmd.LbaLow = test
+	if err := NewAtaTransport(sysutilProvider, device).AtaCommand(f.Fd(), &cmd); err != nil {
+		return readError(device, fmt.Sprintf("S.M.A.R.T self-test %#x execution", test), err)
+	}
+	return nil
+}
+
+// Introduced to make mocking possible. See ExecuteSelfTest_.
+var ExecuteSelfTest = ExecuteSelfTest_
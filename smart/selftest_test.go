@@ -0,0 +1,242 @@
+//
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Provider returning logs read with ATA PASS-THROUGH by log address.
+// Writes to logs given in Logs succeed.
+type fakeLogProvider struct {
+	fakeSysutilProvider
+
+	Logs    map[byte][]byte
+	LogArgs []ScsiCommand
+}
+
+func (s *fakeLogProvider) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	s.LogArgs = append(s.LogArgs, *cmd)
+	data, ok := s.Logs[cmd.Cdb[8]]
+	if !ok {
+		return errors.New("not supported")
+	}
+	if cmd.Cdb[14] == ata_read_log_ext {
+		// Pages of log, starting from the requested one
+		data = data[int(cmd.Cdb[10])*512:]
+	}
+	if !cmd.DataOut {
+		copy(cmd.Data, data)
+	}
+	return nil
+}
+
+func putSelfTest(data []byte, i int, kind, status byte, hours uint16, lba uint32) {
+	d := data[2+i*selftest_entry_length:]
+	d[0], d[1] = kind, status
+	binary.LittleEndian.PutUint16(d[2:4], hours)
+	binary.LittleEndian.PutUint32(d[5:9], lba)
+}
+
+func putExtSelfTest(data []byte, i int, kind, status byte, hours uint16, lba uint64) {
+	d := data[i/ext_selftest_entries_per_page*512+ext_selftest_descriptors_offset+
+		i%ext_selftest_entries_per_page*ext_selftest_entry_length:]
+	d[0], d[1] = kind, status
+	binary.LittleEndian.PutUint16(d[2:4], hours)
+	for j := 0; j < 6; j++ {
+		d[5+j] = byte(lba >> uint(8*j))
+	}
+}
+
+// SMART self-test log with short test passed, extended test failed with
+// read element failure and the most recent short test in progress.
+func selfTestLogFixture() []byte {
+	data := make([]byte, 512)
+	putSelfTest(data, 0, 0x01, 0x00, 100, 0xffffffff)
+	putSelfTest(data, 1, 0x02, 0x70, 120, 0x0123456)
+	putSelfTest(data, 2, 0x01, 0xf3, 130, 0xffffffff)
+	data[selftest_index_offset] = 3
+	return data
+}
+
+func TestParseSelfTestLog(t *testing.T) {
+	Convey("Decoding SMART self-test log", t, func() {
+
+		log, err := ParseSelfTestLog(selfTestLogFixture())
+
+		So(err, ShouldBeNil)
+
+		Convey("Entries are ordered from the most recent", func() {
+
+			So(log.Entries, ShouldResemble, []SelfTestEntry{
+				{Type: 0x01, Status: 0xf, Remaining: 30, Hours: 130, FailingLba: 0xffffffff},
+				{Type: 0x02, Status: 0x7, Remaining: 0, Hours: 120, FailingLba: 0x0123456},
+				{Type: 0x01, Status: 0x0, Remaining: 0, Hours: 100, FailingLba: 0xffffffff},
+			})
+
+		})
+
+		Convey("The most recent test and failed ones are published", func() {
+
+			So(log.GetAttributes(), ShouldResemble, map[string]interface{}{
+				"selftest/failed":                 uint64(1),
+				"selftest/last/type":              uint64(1),
+				"selftest/last/status":            uint64(0xf),
+				"selftest/last/remaining_percent": uint64(30),
+				"selftest/last/hours":             uint64(130),
+			})
+
+		})
+
+	})
+
+	Convey("Decoding wrapped SMART self-test log", t, func() {
+
+		data := make([]byte, 512)
+		for i := 0; i < selftest_log_entries; i++ {
+			putSelfTest(data, i, 0x01, 0x00, uint16(i), 0)
+		}
+		putSelfTest(data, 0, 0x02, 0x30, 50, 0x1000)
+		data[selftest_index_offset] = 1
+
+		log, err := ParseSelfTestLog(data)
+
+		So(err, ShouldBeNil)
+		So(len(log.Entries), ShouldEqual, selftest_log_entries)
+		So(log.Entries[0].Hours, ShouldEqual, 50)
+		So(log.Entries[1].Hours, ShouldEqual, selftest_log_entries-1)
+
+		Convey("Failing LBA of failed test is published", func() {
+
+			attrs := log.GetAttributes()
+			So(attrs["selftest/last/failinglba"], ShouldEqual, 0x1000)
+			So(attrs["selftest/failed"], ShouldEqual, 1)
+
+		})
+
+	})
+
+	Convey("Decoding empty SMART self-test log", t, func() {
+
+		log, err := ParseSelfTestLog(make([]byte, 512))
+
+		So(err, ShouldBeNil)
+		So(log.Entries, ShouldBeEmpty)
+		So(log.GetAttributes(), ShouldResemble, map[string]interface{}{
+			"selftest/failed": uint64(0),
+		})
+
+	})
+
+	Convey("Decoding truncated SMART self-test log", t, func() {
+
+		_, err := ParseSelfTestLog(make([]byte, 100))
+
+		So(err, ShouldNotBeNil)
+
+	})
+
+	Convey("Decoding extended self-test log spanning two pages", t, func() {
+
+		data := make([]byte, 1024)
+		putExtSelfTest(data, 18, 0x01, 0x00, 200, 0)
+		putExtSelfTest(data, 19, 0x02, 0x70, 210, 0x123456789abc)
+		binary.LittleEndian.PutUint16(data[2:4], 20)
+
+		log, err := ParseExtSelfTestLog(data)
+
+		So(err, ShouldBeNil)
+		So(log.Entries, ShouldResemble, []SelfTestEntry{
+			{Type: 0x02, Status: 0x7, Hours: 210, FailingLba: 0x123456789abc},
+			{Type: 0x01, Status: 0x0, Hours: 200},
+		})
+
+	})
+}
+
+func TestReadSelfTestLog(t *testing.T) {
+	Convey("Reading self-test log of device supporting extended log", t, func() {
+
+		directory := make([]byte, 512)
+		binary.LittleEndian.PutUint16(directory[2*ext_selftest_log:], 1)
+		ext := make([]byte, 512)
+		putExtSelfTest(ext, 0, 0x01, 0x00, 300, 0)
+		binary.LittleEndian.PutUint16(ext[2:4], 1)
+
+		provider := &fakeLogProvider{
+			fakeSysutilProvider: fakeSysutilProvider{IoctlRets: []error{errors.New("EINVAL")}},
+			Logs:                map[byte][]byte{gpl_log_directory: directory, ext_selftest_log: ext},
+		}
+		log, err := ReadSelfTestLog("MYDEV", provider)
+
+		Convey("Should read it using READ LOG EXT", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.LogArgs), ShouldEqual, 2)
+			cdb := provider.LogArgs[1].Cdb
+			So(cdb[1]&sat_extend, ShouldEqual, sat_extend)
+			So(cdb[6], ShouldEqual, 1)
+			So(cdb[14], ShouldEqual, ata_read_log_ext)
+			So(log.Entries[0].Hours, ShouldEqual, 300)
+
+		})
+
+	})
+
+	Convey("Reading self-test log of device without extended log", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, smart_selftest_log, smart_read_log, 1}, selfTestLogFixture()...)}
+		log, err := ReadSelfTestLog("MYDEV", provider)
+
+		Convey("Should read it using SMART READ LOG", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(provider.IoctlArgs[0].cmd, ShouldEqual, hdio_drive_cmd)
+			So(provider.IoctlArgs[0].buf[1], ShouldEqual, smart_selftest_log)
+			So(len(log.Entries), ShouldEqual, 3)
+
+		})
+
+	})
+
+	Convey("When device has no self-test log", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{errors.New("EIO")}}
+		_, err := ReadSelfTestLog("MYDEV", provider)
+
+		Convey("Should report error", func() {
+
+			So(err, ShouldNotBeNil)
+
+		})
+
+	})
+}
@@ -0,0 +1,181 @@
+// +build linux
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2015 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+const (
+	sg_io             = 0x2285
+	sg_interface_id   = 'S'
+	sg_dxfer_none     = -1
+	sg_dxfer_to_dev   = -2
+	sg_dxfer_from_dev = -3
+	sg_timeout_ms     = 60000
+	sg_driver_sense   = 0x08
+
+	scsi_status_good            = 0x00
+	scsi_status_check_condition = 0x02
+
+	// Response codes of sense data
+	sense_fixed_current       = 0x70
+	sense_fixed_deferred      = 0x71
+	sense_descriptor_current  = 0x72
+	sense_descriptor_deferred = 0x73
+)
+
+// ScsiCommand describes SCSI command issued to device.
+// Data is transferred from device, unless DataOut is set. Sense is
+// truncated to length of returned sense data.
+type ScsiCommand struct {
+	Cdb     []byte
+	Data    []byte
+	DataOut bool
+	Sense   []byte
+
+	Status byte
+}
+
+// scsiStatusError describes SCSI command completed with given status.
+// Commands rejected as illegal requests are not supported by device.
+func scsiStatusError(what string, status byte, sense []byte) error {
+	key := senseKey(sense)
+	code := ErrorIoctlFailed
+	if status == scsi_status_check_condition && key == sense_key_illegal_request {
+		code = ErrorUnsupported
+	}
+	return &DeviceError{
+		Code:    code,
+		Message: fmt.Sprintf("%s failed, status = %#x, sense key = %#x", what, status, key),
+	}
+}
+
+// senseKey extracts sense key from fixed or descriptor format sense data.
+func senseKey(sense []byte) byte {
+	if len(sense) < 3 {
+		return sense_key_no_sense
+	}
+	switch sense[0] & 0x7f {
+	case sense_descriptor_current, sense_descriptor_deferred:
+		return sense[1] & 0x0f
+	case sense_fixed_current, sense_fixed_deferred:
+		return sense[2] & 0x0f
+	}
+	return sense_key_no_sense
+}
+
+// senseDescriptor finds descriptor of given type in descriptor format
+// sense data. It returns nil if there is no such descriptor.
+func senseDescriptor(sense []byte, code byte) []byte {
+	if len(sense) < 8 {
+		return nil
+	}
+	switch sense[0] & 0x7f {
+	case sense_descriptor_current, sense_descriptor_deferred:
+	default:
+		return nil
+	}
+
+	end := 8 + int(sense[7])
+	if end > len(sense) {
+		end = len(sense)
+	}
+	for i := 8; i+1 < end; i += 2 + int(sense[i+1]) {
+		if sense[i] == code {
+			if i+2+int(sense[i+1]) > end {
+				return nil
+			}
+			return sense[i : i+2+int(sense[i+1])]
+		}
+	}
+	return nil
+}
+
+// Layout of struct sg_io_hdr from scsi/sg.h.
+type sgIoHdr struct {
+	interfaceId    int32
+	dxferDirection int32
+	cmdLen         uint8
+	mxSbLen        uint8
+	iovecCount     uint16
+	dxferLen       uint32
+	dxferp         uintptr
+	cmdp           uintptr
+	sbp            uintptr
+	timeout        uint32
+	flags          uint32
+	packId         int32
+	usrPtr         uintptr
+	status         uint8
+	maskedStatus   uint8
+	msgStatus      uint8
+	sbLenWr        uint8
+	hostStatus     uint16
+	driverStatus   uint16
+	resid          int32
+	duration       uint32
+	info           uint32
+}
+
+func (s *sysutilProviderLinux) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	h := sgIoHdr{
+		interfaceId:    sg_interface_id,
+		dxferDirection: sg_dxfer_none,
+		cmdLen:         uint8(len(cmd.Cdb)),
+		cmdp:           uintptr(unsafe.Pointer(&cmd.Cdb[0])),
+		timeout:        sg_timeout_ms,
+	}
+	if len(cmd.Data) > 0 {
+		h.dxferDirection = sg_dxfer_from_dev
+		if cmd.DataOut {
+			h.dxferDirection = sg_dxfer_to_dev
+		}
+		h.dxferLen = uint32(len(cmd.Data))
+		h.dxferp = uintptr(unsafe.Pointer(&cmd.Data[0]))
+	}
+	if len(cmd.Sense) > 0 {
+		h.mxSbLen = uint8(len(cmd.Sense))
+		h.sbp = uintptr(unsafe.Pointer(&cmd.Sense[0]))
+	}
+
+	buf := (*[unsafe.Sizeof(h)]byte)(unsafe.Pointer(&h))[:]
+	err := s.Ioctl(fd, sg_io, buf)
+	runtime.KeepAlive(cmd)
+	if err != nil {
+		return err
+	}
+
+	if h.hostStatus != 0 || h.driverStatus&^sg_driver_sense != 0 {
+		return &DeviceError{
+			Code: ErrorIoctlFailed,
+			Message: fmt.Sprintf("SG_IO failed, host status = %#x, driver status = %#x",
+				h.hostStatus, h.driverStatus),
+		}
+	}
+	cmd.Status = h.status
+	cmd.Sense = cmd.Sense[:h.sbLenWr]
+
+	return nil
+}
@@ -22,25 +22,34 @@ limitations under the License.
 package smart
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
-	"unicode"
 	"unsafe"
 )
 
 const (
 	hdio_drive_cmd        = 0x031f
+	hdio_drive_task       = 0x031e
 	win_smart             = 0xb0
 	smart_read_values     = 0xd0
 	smart_read_thresholds = 0xd1
+	smart_read_log        = 0xd5
+	smart_write_log       = 0xd6
+	smart_execute_offline = 0xd4
 	smart_enable          = 0xd8
+	smart_status          = 0xda
 	nr_attributes         = 30
+
+	// Values of LBA mid and high registers returned by SMART RETURN STATUS
+	// when threshold is exceeded
+	smart_status_failed_lo = 0xf4
+	smart_status_failed_hi = 0x2c
 )
 
 type AttributeFormat int
@@ -52,6 +61,18 @@ const (
 	FormatPLPF
 	FormatFP1024
 	FormatTTS
+	// Formats compatible with smartmontools
+	FormatRaw48
+	FormatRaw16Avg16
+	FormatRaw24Raw24
+	FormatHex48
+	FormatMin2Hour
+	FormatSec2Hour
+	FormatHalfMin2Hour
+	FormatMsec24Hour32
+	FormatTempMinMax
+	FormatTemp10x
+	FormatRaw16Raw16
 )
 
 type Attribute struct {
@@ -60,7 +81,11 @@ type Attribute struct {
 }
 
 // Connects attribute ID with its label and format of raw data.
-var AttributeMap = map[byte]Attribute{
+type AttributeDefinitions map[byte]Attribute
+
+// Built-in attribute definitions, used for drives not matched by
+// attribute definition database.
+var AttributeMap = AttributeDefinitions{
 	0x05: {"reallocatedsectors", FormatDefault},
 	0x09: {"poweronhours", FormatDefault},
 	0x0c: {"powercyclecount", FormatDefault},
@@ -88,27 +113,59 @@ var AttributeMap = map[byte]Attribute{
 	0xf2: {"totallba/read", FormatDefault},
 }
 
-// Data format for single attribute.
+// Data format for single attribute. Data holds current normalized value.
 type SmartValue struct {
-	Id     byte
-	Status int16
-	Data   byte
-	Vendor [8]byte
+	Id       byte
+	Flags    uint16
+	Data     byte
+	Worst    byte
+	Raw      [6]byte
+	Reserved byte
 }
 
+// Bits of attribute flags.
+const (
+	AttributeFlagPrefailure  = 1 << 0
+	AttributeFlagOnline      = 1 << 1
+	AttributeFlagPerformance = 1 << 2
+)
+
 // Data format for smart binary data.
 type SmartValues struct {
 	Revision          int16
 	Values            [nr_attributes]SmartValue
 	OfflineStatus     byte
-	Vendor1           byte
+	SelfTestStatus    byte
 	OfflineTimeout    int16
 	Vendor2           byte
 	OfflineCapability byte
 	SmartCapability   int16
-	Reserved          [16]byte
-	Vendor            [125]byte
-	Checksum          byte
+	// Fields below are defined since ATA-4, they are zero in older devices
+	ErrorLogging            byte
+	Vendor3                 byte
+	ShortPollingTime        byte
+	ExtendedPollingTime     byte
+	ConveyancePollingTime   byte
+	ExtendedPollingTimeWord uint16
+	Reserved                [9]byte
+	Vendor                  [125]byte
+	Checksum                byte
+}
+
+// Data format for single attribute threshold.
+type SmartThreshold struct {
+	Id        byte
+	Threshold byte
+	Reserved  [10]byte
+}
+
+// Data format for smart thresholds binary data.
+type SmartThresholds struct {
+	Revision int16
+	Values   [nr_attributes]SmartThreshold
+	Reserved [18]byte
+	Vendor   [131]byte
+	Checksum byte
 }
 
 // ReadSmartData_ enables SMART on device and retrieves binary data from it.
@@ -116,105 +173,197 @@ type SmartValues struct {
 func ReadSmartData_(device string, sysutilProvider SysutilProvider) (*SmartValues, error) {
 	f, err := sysutilProvider.OpenDevice(device)
 	if err != nil {
-		return nil, errors.New(device + ": Can't open device")
+		return nil, openError(device)
 	}
 	defer f.Close()
 
-	if err := enableSmart(f.Fd(), sysutilProvider); err != nil {
-		return nil, errors.New(fmt.Sprintf("%s: %s", device, err))
+	transport := NewAtaTransport(sysutilProvider, device)
+	if err := enableSmart(f.Fd(), transport); err != nil {
+		return nil, readError(device, "S.M.A.R.T enable", err)
+	}
+
+	return readSmartValues(device, f.Fd(), transport)
+}
+
+// ReadSmartValues_ retrieves binary data from device without enabling SMART,
+// which is expected to be already enabled.
+func ReadSmartValues_(device string, sysutilProvider SysutilProvider) (*SmartValues, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
 	}
+	defer f.Close()
+
+	return readSmartValues(device, f.Fd(), NewAtaTransport(sysutilProvider, device))
+}
 
-	buf := make([]byte, 4+512)
-	buf[0] = win_smart
-	buf[1] = 0
-	buf[2] = smart_read_values
-	buf[3] = 1
+func readSmartValues(device string, fd uintptr, transport AtaTransport) (*SmartValues, error) {
+	cmd := smartCommand(smart_read_values)
+	cmd.Count = 1
+	cmd.Data = make([]byte, 512)
 
-	if err := sysutilProvider.Ioctl(f.Fd(), hdio_drive_cmd, buf); err != nil {
-		return nil, errors.New(fmt.Sprintf(
-			"%s: S.M.A.R.T Reading failed, error = %v", device, err))
+	if err := transport.AtaCommand(fd, &cmd); err != nil {
+		return nil, readError(device, "S.M.A.R.T Reading", err)
 	}
 
+	values, err := ParseSmartValues(cmd.Data)
+	if err != nil {
+		return nil, readError(device, "S.M.A.R.T Reading", err)
+	}
+
+	return values, nil
+}
+
+// SectorChecksumValid verifies checksum of SMART data structure, stored in
+// its last byte, which makes sum of all bytes zero.
+func SectorChecksumValid(data []byte) bool {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum == 0
+}
+
+// ParseSmartValues decodes SMART data sector. Sectors with invalid
+// checksum or revision, e.g. garbage returned by faulty bridges, are
+// rejected as corrupt.
+func ParseSmartValues(data []byte) (*SmartValues, error) {
+	if len(data) != 512 {
+		return nil, corruptError("S.M.A.R.T data has %d bytes", len(data))
+	}
+	if !SectorChecksumValid(data) {
+		return nil, corruptError("S.M.A.R.T data checksum invalid")
+	}
 	values := SmartValues{}
-	smart_data := bytes.NewBuffer(buf[4:])
-	binary.Read(smart_data, binary.LittleEndian, &values)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &values); err != nil {
+		return nil, corruptError("S.M.A.R.T data not decoded, %v", err)
+	}
+	// Revision is never 0 and FFFFh would be read from erased sector
+	if values.Revision == 0 || values.Revision == -1 {
+		return nil, corruptError("S.M.A.R.T data revision %#04x invalid", uint16(values.Revision))
+	}
 
 	return &values, nil
 }
 
-func enableSmart(fd uintptr, sysutilProvider SysutilProvider) error {
-	buf := make([]byte, 4+512)
-	buf[0] = win_smart
-	buf[1] = 0
-	buf[2] = smart_enable
-	buf[3] = 0
-	e := sysutilProvider.Ioctl(fd, hdio_drive_cmd, buf)
-	if e != nil {
-		return errors.New("Can't enable S.M.A.R.T")
+// ReadSmartThresholds_ retrieves attribute thresholds from device.
+// SMART is expected to be already enabled, see ReadSmartData_.
+func ReadSmartThresholds_(device string, sysutilProvider SysutilProvider) (*SmartThresholds, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return nil, openError(device)
 	}
-	return nil
+	defer f.Close()
+
+	cmd := smartCommand(smart_read_thresholds)
+	cmd.Count = 1
+	cmd.LbaLow = 1
+	cmd.Data = make([]byte, 512)
+
+	if err := NewAtaTransport(sysutilProvider, device).AtaCommand(f.Fd(), &cmd); err != nil {
+		return nil, readError(device, "S.M.A.R.T thresholds reading", err)
+	}
+
+	thresholds, err := ParseSmartThresholds(cmd.Data)
+	if err != nil {
+		return nil, readError(device, "S.M.A.R.T thresholds reading", err)
+	}
+
+	return thresholds, nil
 }
 
-// Parses 8 bytes of raw data in a way specific to this format.
-// It returns map of values. Main value is accessible using empty string.
-// Additional values are accessible using "/[additonal value]"
-func (a AttributeFormat) ParseRaw(data [8]byte) map[string]interface{} {
-	switch a {
-	case FormatDefault:
-		return map[string]interface{}{"": uint64(data[1]) + uint64(data[2])<<8 +
-			uint64(data[3])<<16 + uint64(data[4])<<24 +
-			uint64(data[5])<<32 + uint64(data[5])<<40}
-	case FormatFP1024:
-		return map[string]interface{}{"": float64(uint64(data[1])+uint64(data[2])<<8+
-			uint64(data[3])<<16+uint64(data[4])<<24+
-			uint64(data[5])<<32+uint64(data[5])<<40) / 1024}
-	case FormatPLPF:
-		return map[string]interface{}{"": uint64(data[1]) + uint64(data[2])<<8,
-			"/sincelast": uint64(data[3]) + uint64(data[4])<<8,
-			"/tests":     uint64(data[5]) + uint64(data[6])<<8}
-	case FormatTemperature:
-		return map[string]interface{}{"": uint64(data[1]) + uint64(data[2])<<8,
-			"/min": uint64(data[3]), "/max": uint64(data[4]),
-			"/overcounter": uint64(data[5]) + uint64(data[6])<<8,
-		}
-	case FormatTTS:
-		return map[string]interface{}{"": uint64(data[1]),
-			"/eventcount": uint64(data[2]) + uint64(data[3])<<8 +
-				uint64(data[4])<<16 + uint64(data[5])<<24,
-		}
+// ParseSmartThresholds decodes SMART thresholds sector, which is validated
+// the same way as SMART data sector, see ParseSmartValues.
+func ParseSmartThresholds(data []byte) (*SmartThresholds, error) {
+	if len(data) != 512 {
+		return nil, corruptError("S.M.A.R.T thresholds have %d bytes", len(data))
+	}
+	if !SectorChecksumValid(data) {
+		return nil, corruptError("S.M.A.R.T thresholds checksum invalid")
+	}
+	thresholds := SmartThresholds{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &thresholds); err != nil {
+		return nil, corruptError("S.M.A.R.T thresholds not decoded, %v", err)
+	}
+	if thresholds.Revision == 0 || thresholds.Revision == -1 {
+		return nil, corruptError("S.M.A.R.T thresholds revision %#04x invalid", uint16(thresholds.Revision))
+	}
+
+	return &thresholds, nil
+}
+
+// ReadSmartStatus_ checks overall device health using SMART RETURN STATUS.
+// It returns false when device reports that any of its thresholds was exceeded.
+func ReadSmartStatus_(device string, sysutilProvider SysutilProvider) (bool, error) {
+	f, err := sysutilProvider.OpenDevice(device)
+	if err != nil {
+		return false, openError(device)
+	}
+	defer f.Close()
+
+	cmd := smartCommand(smart_status)
+	cmd.Registers = true
+
+	if err := NewAtaTransport(sysutilProvider, device).AtaCommand(f.Fd(), &cmd); err != nil {
+		return false, readError(device, "S.M.A.R.T status reading", err)
+	}
+
+	switch {
+	case cmd.LbaMid == smart_lba_mid && cmd.LbaHigh == smart_lba_hi:
+		return true, nil
+	case cmd.LbaMid == smart_status_failed_lo && cmd.LbaHigh == smart_status_failed_hi:
+		return false, nil
 	}
 
+	return false, &DeviceError{
+		Code:    ErrorUnsupported,
+		Device:  device,
+		Message: fmt.Sprintf("S.M.A.R.T status unknown, registers = %#x %#x", cmd.LbaMid, cmd.LbaHigh),
+	}
+}
+
+func enableSmart(fd uintptr, transport AtaTransport) error {
+	cmd := smartCommand(smart_enable)
+	e := transport.AtaCommand(fd, &cmd)
+	if e != nil {
+		return e
+	}
 	return nil
 }
 
 // Introduced to make mocking possible. See ReadSmartData_.
 var ReadSmartData = ReadSmartData_
 
-// GetKeys returns list of keys that can be used to access parsed values
-// of particular format.
-func (a AttributeFormat) GetKeys() []string {
-	ret := []string{}
-	switch a {
-	case FormatPLPF:
-		ret = []string{"/sincelast", "/tests"}
-	case FormatTemperature:
-		ret = []string{"/min", "/max", "/overcounter"}
-	case FormatTTS:
-		ret = []string{"/eventcount"}
-	}
-	return append([]string{"", "/normalized"}, ret...)
-}
+// Introduced to make mocking possible. See ReadSmartValues_.
+var ReadSmartValues = ReadSmartValues_
+
+// Introduced to make mocking possible. See ReadSmartThresholds_.
+var ReadSmartThresholds = ReadSmartThresholds_
+
+// Introduced to make mocking possible. See ReadSmartStatus_.
+var ReadSmartStatus = ReadSmartStatus_
 
 // GetAttributes transforms smart data structure to map containing attributes'
 // values. Main value is accessed using label.
 // Additional values are accessed using "[label]/[additonal value]".
 func (sv SmartValues) GetAttributes() map[string]interface{} {
+	return sv.GetAttributesFor(AttributeMap)
+}
+
+// GetAttributesFor works as GetAttributes, but uses given attribute
+// definitions instead of built-in ones.
+func (sv SmartValues) GetAttributesFor(defs AttributeDefinitions) map[string]interface{} {
 	ret_val := map[string]interface{}{}
 	for i := 0; i < nr_attributes; i++ {
-		a, ok := AttributeMap[sv.Values[i].Id]
+		a, ok := defs[sv.Values[i].Id]
 		if ok {
 			ret_val[a.Name+"/normalized"] = sv.Values[i].Data
-			attrib_content := a.Format.ParseRaw(sv.Values[i].Vendor)
+			ret_val[a.Name+"/worst"] = sv.Values[i].Worst
+			flags := sv.Values[i].Flags
+			ret_val[a.Name+"/prefailure"] = flags&AttributeFlagPrefailure != 0
+			ret_val[a.Name+"/online"] = flags&AttributeFlagOnline != 0
+			ret_val[a.Name+"/performance"] = flags&AttributeFlagPerformance != 0
+			attrib_content := a.Format.ParseValue(sv.Values[i])
 			for k, v := range attrib_content {
 				ret_val[a.Name+k] = v
 			}
@@ -223,33 +372,232 @@ func (sv SmartValues) GetAttributes() map[string]interface{} {
 	return ret_val
 }
 
-// Returns list of keys that can be used to access all values of all formats.
-// Which is cross product of attributes' label and (sub)value keys.
-func ListAllKeys() []string {
+// RawValue returns raw data of attribute as 48-bit value.
+func (v SmartValue) RawValue() uint64 {
+	ret := uint64(0)
+	for i := len(v.Raw) - 1; i >= 0; i-- {
+		ret = ret<<8 + uint64(v.Raw[i])
+	}
+	return ret
+}
+
+// Keys of values available for every attribute, regardless of its definition.
+var idKeys = []string{"/raw", "/normalized", "/worst"}
+
+// idPrefix returns prefix of keys of values of attribute with given ID.
+func idPrefix(id byte) string {
+	return fmt.Sprintf("id/%03d", id)
+}
+
+// GetAttributesById transforms smart data structure to map containing
+// values of all attributes present, including ones not defined.
+// Values are accessed using "id/[NNN]/raw", "id/[NNN]/normalized" and
+// "id/[NNN]/worst", where NNN is decimal attribute ID.
+func (sv SmartValues) GetAttributesById() map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	for i := 0; i < nr_attributes; i++ {
+		v := sv.Values[i]
+		if v.Id == 0 {
+			continue
+		}
+		prefix := idPrefix(v.Id)
+		ret_val[prefix+"/raw"] = v.RawValue()
+		ret_val[prefix+"/normalized"] = v.Data
+		ret_val[prefix+"/worst"] = v.Worst
+	}
+	return ret_val
+}
+
+// Returns list of keys that can be used to access values of attributes
+// by their IDs, see GetAttributesById. Attribute ID is dynamic element.
+func listIdKeys() []string {
 	keys := []string{}
-	for _, v := range AttributeMap {
+	for _, k := range idKeys {
+		keys = append(keys, "id/"+dynamicElement(attributeIdElement)+k)
+	}
+	return keys
+}
+
+// GetAttributes transforms thresholds data structure to map containing
+// attributes' thresholds and information whether normalized value given in
+// smart data crossed the threshold.
+// Values are accessed using "[label]/threshold" and "[label]/failing".
+func (st SmartThresholds) GetAttributes(sv SmartValues) map[string]interface{} {
+	return st.GetAttributesFor(sv, AttributeMap)
+}
+
+// GetAttributesFor works as GetAttributes, but uses given attribute
+// definitions instead of built-in ones.
+func (st SmartThresholds) GetAttributesFor(sv SmartValues, defs AttributeDefinitions) map[string]interface{} {
+	ret_val := map[string]interface{}{}
+	for i := 0; i < nr_attributes; i++ {
+		a, ok := defs[st.Values[i].Id]
+		if !ok {
+			continue
+		}
+		for j := 0; j < nr_attributes; j++ {
+			if sv.Values[j].Id != st.Values[i].Id {
+				continue
+			}
+			threshold := st.Values[i].Threshold
+			ret_val[a.Name+"/threshold"] = threshold
+			// Threshold of 0 means attribute can never fail
+			ret_val[a.Name+"/failing"] = threshold != 0 &&
+				sv.Values[j].Data <= threshold
+			break
+		}
+	}
+	return ret_val
+}
+
+// CountFailing returns number of attributes, including ones not present
+// in attribute definitions, which normalized value crossed the threshold.
+func (st SmartThresholds) CountFailing(sv SmartValues) int {
+	count := 0
+	for i := 0; i < nr_attributes; i++ {
+		if st.Values[i].Id == 0 || st.Values[i].Threshold == 0 {
+			continue
+		}
+		for j := 0; j < nr_attributes; j++ {
+			if sv.Values[j].Id == st.Values[i].Id {
+				if sv.Values[j].Data <= st.Values[i].Threshold {
+					count++
+				}
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Keys of values available for every defined attribute besides ones
+// specific to its format.
+var attributeKeys = []string{"/worst", "/prefailure", "/online", "/performance"}
+
+// Keys of values derived from attribute thresholds, see SmartThresholds.
+var thresholdKeys = []string{"/threshold", "/failing"}
+
+// Keys of values describing overall device health.
+var healthKeys = []string{"health/passed", "health/failingattributes"}
+
+// Key of power mode of device, see SmartCollector.checkPowerMode.
+var powerModeKey = "powermode"
+
+// ListKeys returns list of keys that can be used to access values of
+// defined attributes. Which is cross product of attributes' label
+// and (sub)value keys.
+func (defs AttributeDefinitions) ListKeys() []string {
+	keys := []string{}
+	for _, v := range defs {
 		for _, f := range v.Format.GetKeys() {
 			keys = append(keys, v.Name+f)
 		}
+		for _, f := range attributeKeys {
+			keys = append(keys, v.Name+f)
+		}
+		for _, f := range thresholdKeys {
+			keys = append(keys, v.Name+f)
+		}
 	}
+	return keys
+}
+
+// Returns list of keys that can be used to access all values of all formats
+// of built-in attributes and values not related to attributes.
+func ListAllKeys() []string {
+	keys := AttributeMap.ListKeys()
+	keys = append(keys, healthKeys...)
+	keys = append(keys, collectorKeys...)
+	keys = append(keys, derivedKeys...)
+	keys = append(keys, powerModeKey)
+	keys = append(keys, selfTestKeys...)
+	keys = append(keys, selfTestProgressKeys...)
+	keys = append(keys, scheduledSelfTestKey)
+	keys = append(keys, listCapabilityKeys()...)
+	keys = append(keys, errorLogKeys...)
+	keys = append(keys, errorLogDeltaKey)
+	keys = append(keys, listDevstatKeys()...)
+	keys = append(keys, listSctKeys()...)
+	keys = append(keys, listIdKeys()...)
+	keys = append(keys, nvmeKeys...)
+	keys = append(keys, listScsiKeys()...)
 
 	return keys
 }
 
+// Names of dynamic elements of keys
+const (
+	attributeIdElement = "attribute_id"
+	sampleElement      = "sample"
+)
+
+// Descriptions of dynamic elements of keys, by name.
+var dynamicElements = map[string]string{
+	attributeIdElement: "decimal ID of SMART attribute",
+	sampleElement:      "number of temperature history sample, 000 is the most recent one",
+}
+
+// dynamicElement returns element of key, which stands for dynamic element
+// of namespace with given name.
+func dynamicElement(name string) string {
+	return "[" + name + "]"
+}
+
+// parseDynamicElement returns name of dynamic element given element of key
+// stands for, if it does.
+func parseDynamicElement(elt string) (string, bool) {
+	if !strings.HasPrefix(elt, "[") || !strings.HasSuffix(elt, "]") {
+		return "", false
+	}
+	name := elt[1 : len(elt)-1]
+	_, ok := dynamicElements[name]
+	return name, ok
+}
+
 // Represents OS abstraction layer, currently used for mocking.
 type SysutilProvider interface {
 	OpenDevice(device string) (*os.File, error)
 	Ioctl(fd uintptr, cmd uint, buf []byte) error
+	NvmeAdmin(fd uintptr, cmd *NvmeAdminCommand) error
+	SgIo(fd uintptr, cmd *ScsiCommand) error
 	ListDevices() ([]string, error)
 }
 
 type sysutilProviderLinux struct {
 	proc_path string
 	dev_path  string
+	sys_path  string
+	read_only bool
+	// Indices of ATA transports selected for devices, see transportMemory
+	transports      map[string]int
+	transportsMutex sync.Mutex
+}
+
+func (s *sysutilProviderLinux) SelectedTransport(device string) (int, bool) {
+	s.transportsMutex.Lock()
+	defer s.transportsMutex.Unlock()
+	i, ok := s.transports[device]
+	return i, ok
+}
+
+func (s *sysutilProviderLinux) SelectTransport(device string, index int) {
+	s.transportsMutex.Lock()
+	defer s.transportsMutex.Unlock()
+	s.transports[device] = index
+}
+
+func (s *sysutilProviderLinux) ForgetTransport(device string) {
+	s.transportsMutex.Lock()
+	defer s.transportsMutex.Unlock()
+	delete(s.transports, device)
 }
 
 func (s *sysutilProviderLinux) OpenDevice(device string) (*os.File, error) {
-	f, err := os.OpenFile(s.dev_path+"/"+device, os.O_RDWR, 0)
+	flags := os.O_RDWR
+	if s.read_only {
+		flags = os.O_RDONLY | syscall.O_NONBLOCK
+	}
+	f, err := os.OpenFile(s.dev_path+"/"+device, flags, 0)
 	return f, err
 }
 
@@ -257,6 +605,12 @@ func (s *sysutilProviderLinux) Ioctl(fd uintptr, cmd uint, buf []byte) error {
 	ptr := uintptr(unsafe.Pointer(&buf[0]))
 	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(cmd), ptr)
 
+	if s.read_only && (e == syscall.EPERM || e == syscall.EACCES) {
+		return &DeviceError{
+			Code:    ErrorIoctlFailed,
+			Message: fmt.Sprintf("%v, command requires write access to device which is opened read-only", e),
+		}
+	}
 	if e != 0 {
 		return e
 	}
@@ -264,35 +618,28 @@ func (s *sysutilProviderLinux) Ioctl(fd uintptr, cmd uint, buf []byte) error {
 	return nil
 }
 
+// ListDevices lists devices found in sysfs.
 func (s *sysutilProviderLinux) ListDevices() ([]string, error) {
-	result := []string{}
-
-	f, err := os.Open(s.proc_path + "/partitions")
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	scan := bufio.NewScanner(f)
-	for scan.Scan() {
-		if len(scan.Text()) < 1 {
-			continue
-		}
-
-		table := strings.Fields(scan.Text())
-		if table[0] == "8" && strings.IndexFunc(table[3], unicode.IsDigit) < 0 {
-			result = append(result, table[3])
-		}
+	return listSysfsDevices(filepath.Join(s.sys_path, "block"))
+}
 
+func NewSysutilProvider(procPath string, devPath string, sysPath string) SysutilProvider {
+	return &sysutilProviderLinux{
+		proc_path:  procPath,
+		dev_path:   devPath,
+		sys_path:   sysPath,
+		transports: map[string]int{},
 	}
-
-	return result, nil
-
 }
 
-func NewSysutilProvider(procPath string, devPath string) SysutilProvider {
+// NewReadOnlySysutilProvider returns provider which opens devices read-only.
+// Kernel may refuse some commands without write access to device.
+func NewReadOnlySysutilProvider(procPath string, devPath string, sysPath string) SysutilProvider {
 	return &sysutilProviderLinux{
-		proc_path: procPath,
-		dev_path:  devPath,
+		proc_path:  procPath,
+		dev_path:   devPath,
+		sys_path:   sysPath,
+		read_only:  true,
+		transports: map[string]int{},
 	}
 }
@@ -23,8 +23,11 @@ limitations under the License.
 package smart
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"strings"
 	"testing"
@@ -67,11 +70,35 @@ func (s *fakeSysutilProvider) Ioctl(fd uintptr, cmd uint, buf []byte) error {
 	i := len(s.IoctlArgs)
 	s.IoctlArgs = append(s.IoctlArgs, IoctlArgsType{fd, cmd, buf})
 
-	//if
+	if s.FillBuf != nil {
+		copy(buf, s.FillBuf)
+	}
 
 	return s.IoctlRets[i]
 }
 
+func (s *fakeSysutilProvider) SgIo(fd uintptr, cmd *ScsiCommand) error {
+	return errors.New("not supported")
+}
+
+func (s *fakeSysutilProvider) NvmeAdmin(fd uintptr, cmd *NvmeAdminCommand) error {
+	return errors.New("not supported")
+}
+
+// smartDataFixture returns SMART data sector of given revision, with given
+// bytes at its beginning and valid checksum.
+func smartDataFixture(revision byte, data ...byte) []byte {
+	sector := make([]byte, 512)
+	sector[0] = revision
+	copy(sector[2:], data)
+	var sum byte
+	for _, b := range sector[:511] {
+		sum += b
+	}
+	sector[511] = -sum
+	return sector
+}
+
 func firstKnownMetric() (byte, string) {
 	for k, v := range AttributeMap {
 		if !strings.Contains(v.Name, "/") {
@@ -88,7 +115,8 @@ func TestSmartReader(t *testing.T) {
 	Convey("Reading from smart capable device", t, func() {
 
 		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
-			IoctlRets: []error{nil, nil}}
+			IoctlRets: []error{nil, nil},
+			FillBuf:   append([]byte{win_smart, 0, smart_read_values, 1}, smartDataFixture(0x10)...)}
 		_, err := ReadSmartData("MYDEV", provider)
 
 		Convey("Should call OpenDevice from abstraction layer", func() {
@@ -193,6 +221,140 @@ func TestSmartReader(t *testing.T) {
 
 }
 
+func TestSmartValuesReader(t *testing.T) {
+
+	Convey("Reading without enabling smart", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, 0, smart_read_values, 1}, smartDataFixture(0x10)...)}
+		_, err := ReadSmartValues("MYDEV", provider)
+
+		Convey("Should only read values", func() {
+
+			So(err, ShouldBeNil)
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(provider.IoctlArgs[0].buf[2], ShouldEqual, smart_read_values)
+
+		})
+
+	})
+
+	Convey("When device fails during reading", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{errors.New("Something")}}
+		_, err := ReadSmartValues("MYDEV", provider)
+
+		Convey("Error should be about reading", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Read")
+
+		})
+
+	})
+
+}
+
+func TestParseSmartValues(t *testing.T) {
+
+	Convey("Parsing valid SMART data", t, func() {
+
+		values, err := ParseSmartValues(smartDataFixture(0x10, 0x05))
+
+		So(err, ShouldBeNil)
+		So(values.Revision, ShouldEqual, 0x10)
+		So(values.Values[0].Id, ShouldEqual, 5)
+
+	})
+
+	Convey("Parsing corrupt SMART data", t, func() {
+
+		corrupt := map[string][]byte{
+			"checksum":  smartDataFixture(0x10, 0x05),
+			"revision":  smartDataFixture(0x00, 0x05),
+			"erased":    smartDataFixture(0xff, 0xff),
+			"truncated": smartDataFixture(0x10)[:256],
+		}
+		corrupt["checksum"][100]++
+		corrupt["erased"][1] = 0xff
+		corrupt["erased"][511]++
+
+		for name, data := range corrupt {
+			Convey(fmt.Sprintf("Should reject sector with invalid %s", name), func() {
+				values, err := ParseSmartValues(data)
+				So(values, ShouldBeNil)
+				So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+				So(err.Error(), ShouldContainSubstring, "Corrupt")
+			})
+		}
+
+	})
+
+	Convey("Reading corrupt SMART data", t, func() {
+
+		sector := smartDataFixture(0x10)
+		sector[511]++
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, 0, smart_read_values, 1}, sector...)}
+		values, err := ReadSmartValues("MYDEV", provider)
+
+		So(values, ShouldBeNil)
+		So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+
+	})
+
+}
+
+func TestParseSmartValuesRandomSectors(t *testing.T) {
+
+	Convey("Decoding random sectors", t, func() {
+
+		rnd := rand.New(rand.NewSource(1))
+		accepted := 0
+		for i := 0; i < 10000; i++ {
+			sector := make([]byte, 512)
+			rnd.Read(sector)
+			// Most sectors get valid checksum, so they are decoded
+			fixed := i%10 != 0
+			if fixed {
+				sector = smartDataFixture(sector[0], sector[2:511]...)
+			}
+
+			values, err := ParseSmartValues(sector)
+			if err != nil {
+				So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+				So(fixed && sector[0] != 0, ShouldBeFalse)
+				continue
+			}
+			accepted++
+			values.GetAttributes()
+			values.GetAttributesById()
+			values.GetCapabilities()
+			values.GetSelfTestProgress()
+		}
+
+		Convey("Should never panic and only accept valid sectors", func() {
+			So(accepted, ShouldBeGreaterThan, 8000)
+		})
+
+	})
+
+	Convey("Decoding sectors of random length", t, func() {
+
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			length := rnd.Intn(512)
+			_, err := ParseSmartValues(smartDataFixture(1)[:length])
+			So(err, ShouldNotBeNil)
+		}
+
+	})
+
+}
+
 func TestGetAttributes(t *testing.T) {
 	Convey("When there is no known attribute", t, func() {
 
@@ -232,6 +394,302 @@ func TestGetAttributes(t *testing.T) {
 
 		})
 
+		Convey("Should be present in list of metrics in worst form", func() {
+
+			_, ok := metrics[value+"/worst"]
+			So(ok, ShouldBeTrue)
+
+		})
+
+	})
+
+	Convey("When attribute entry is decoded", t, func() {
+
+		id, value := firstKnownMetric()
+
+		data := make([]byte, 512)
+		data[2] = id
+		binary.LittleEndian.PutUint16(data[3:5], AttributeFlagPrefailure|AttributeFlagPerformance)
+		data[5], data[6] = 100, 42
+		copy(data[7:13], []byte{1, 2, 3, 4, 5, 6})
+		data[13] = 0xff
+
+		sv := SmartValues{}
+		binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &sv)
+		metrics := sv.GetAttributes()
+
+		Convey("Fields are at their offsets", func() {
+
+			So(sv.Values[0].Id, ShouldEqual, id)
+			So(sv.Values[0].Data, ShouldEqual, 100)
+			So(sv.Values[0].Worst, ShouldEqual, 42)
+			So(sv.Values[0].Raw, ShouldResemble, [6]byte{1, 2, 3, 4, 5, 6})
+			So(sv.Values[0].Reserved, ShouldEqual, 0xff)
+
+		})
+
+		Convey("Worst value and flags are published", func() {
+
+			So(metrics[value+"/worst"], ShouldEqual, 42)
+			So(metrics[value+"/prefailure"], ShouldBeTrue)
+			So(metrics[value+"/online"], ShouldBeFalse)
+			So(metrics[value+"/performance"], ShouldBeTrue)
+
+		})
+
+		Convey("Worst value and flags are advertised", func() {
+
+			So(ListAllKeys(), ShouldContain, value+"/worst")
+			So(ListAllKeys(), ShouldContain, value+"/prefailure")
+
+		})
+
+	})
+}
+
+func TestGetAttributesById(t *testing.T) {
+	Convey("When unknown attribute is present", t, func() {
+
+		sv := SmartValues{}
+		sv.Values[0].Id = 202
+		sv.Values[0].Data = 98
+		sv.Values[0].Worst = 97
+		sv.Values[0].Raw = [6]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+		metrics := sv.GetAttributesById()
+
+		Convey("Should be present in list of metrics by its ID", func() {
+
+			So(metrics, ShouldResemble, map[string]interface{}{
+				"id/202/raw":        uint64(0x060504030201),
+				"id/202/normalized": byte(98),
+				"id/202/worst":      byte(97),
+			})
+
+		})
+
+		Convey("Should be advertised", func() {
+
+			So(ListAllKeys(), ShouldContain, "id/[attribute_id]/raw")
+			So(ListAllKeys(), ShouldContain, "id/[attribute_id]/worst")
+			So(ListAllKeys(), ShouldNotContain, "id/202/raw")
+
+		})
+
+	})
+
+	Convey("When there is no attribute", t, func() {
+
+		So(SmartValues{}.GetAttributesById(), ShouldBeEmpty)
+
+	})
+}
+
+func TestSmartThresholds(t *testing.T) {
+	Convey("Reading thresholds from smart capable device", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, 1, smart_read_thresholds, 1}, smartDataFixture(1, 0x05, 0x24)...)}
+		thresholds, err := ReadSmartThresholds("MYDEV", provider)
+
+		Convey("Should call ioctl once", func() {
+
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+
+		})
+
+		Convey("Should ask for thresholds", func() {
+
+			So(provider.IoctlArgs[0].buf[2], ShouldEqual, smart_read_thresholds)
+
+		})
+
+		Convey("Should return decoded thresholds", func() {
+
+			So(err, ShouldBeNil)
+			So(thresholds.Values[0].Id, ShouldEqual, 0x05)
+			So(thresholds.Values[0].Threshold, ShouldEqual, 0x24)
+
+		})
+
+	})
+
+	Convey("When device returns corrupt thresholds", t, func() {
+
+		sector := smartDataFixture(1, 0x05, 0x24)
+		sector[100]++
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   append([]byte{win_smart, 1, smart_read_thresholds, 1}, sector...)}
+		_, err := ReadSmartThresholds("MYDEV", provider)
+
+		Convey("Should report invalid checksum", func() {
+
+			So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+
+		})
+
+		Convey("Should reject truncated sector or invalid revision", func() {
+
+			_, err := ParseSmartThresholds(smartDataFixture(0))
+			So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+			_, err = ParseSmartThresholds(make([]byte, 100))
+			So(ErrorCodeOf(err), ShouldEqual, ErrorChecksum)
+
+		})
+
+	})
+
+	Convey("When device fails during reading thresholds", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{errors.New("Something")}}
+		_, err := ReadSmartThresholds("MYDEV", provider)
+
+		Convey("Error should be about reading thresholds", func() {
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "thresholds")
+
+		})
+
+	})
+
+	Convey("When known attribute has threshold", t, func() {
+
+		id, value := firstKnownMetric()
+
+		sv := SmartValues{}
+		sv.Values[1].Id = id
+		sv.Values[1].Data = 50
+
+		st := SmartThresholds{}
+		st.Values[0].Id = id
+		st.Values[0].Threshold = 10
+
+		metrics := st.GetAttributes(sv)
+
+		Convey("Threshold should be present in list of metrics", func() {
+
+			So(metrics[value+"/threshold"], ShouldEqual, 10)
+
+		})
+
+		Convey("Attribute should not be failing", func() {
+
+			So(metrics[value+"/failing"], ShouldBeFalse)
+
+		})
+
+		Convey("Attribute should be failing when value crosses threshold", func() {
+
+			sv.Values[1].Data = 10
+			So(st.GetAttributes(sv)[value+"/failing"], ShouldBeTrue)
+
+		})
+
+		Convey("Attribute should never fail for zero threshold", func() {
+
+			sv.Values[1].Data = 0
+			st.Values[0].Threshold = 0
+			So(st.GetAttributes(sv)[value+"/failing"], ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("When attribute has no value", t, func() {
+
+		id, _ := firstKnownMetric()
+
+		st := SmartThresholds{}
+		st.Values[0].Id = id
+		st.Values[0].Threshold = 10
+
+		Convey("List of metrics should be empty", func() {
+
+			So(st.GetAttributes(SmartValues{}), ShouldBeEmpty)
+
+		})
+
+	})
+}
+
+func TestSmartStatus(t *testing.T) {
+	Convey("Reading status of healthy device", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil}}
+		passed, err := ReadSmartStatus("MYDEV", provider)
+
+		Convey("Should ask for status using drive task", func() {
+
+			So(len(provider.IoctlArgs), ShouldEqual, 1)
+			So(provider.IoctlArgs[0].cmd, ShouldEqual, hdio_drive_task)
+			So(provider.IoctlArgs[0].buf[1], ShouldEqual, smart_status)
+
+		})
+
+		Convey("Should report device as healthy", func() {
+
+			So(err, ShouldBeNil)
+			So(passed, ShouldBeTrue)
+
+		})
+
+	})
+
+	Convey("Reading status of failing device", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   []byte{win_smart, smart_status, 0, 0, 0xf4, 0x2c, 0}}
+		passed, err := ReadSmartStatus("MYDEV", provider)
+
+		Convey("Should report device as failing", func() {
+
+			So(err, ShouldBeNil)
+			So(passed, ShouldBeFalse)
+
+		})
+
+	})
+
+	Convey("When device returns unexpected status", t, func() {
+
+		provider := &fakeSysutilProvider{OpenDeviceRet: OpenDeviceRetType{nil, nil},
+			IoctlRets: []error{nil},
+			FillBuf:   []byte{win_smart, smart_status, 0, 0, 0, 0, 0}}
+		_, err := ReadSmartStatus("MYDEV", provider)
+
+		Convey("Should report error", func() {
+
+			So(err, ShouldNotBeNil)
+
+		})
+
+	})
+
+	Convey("Counting failing attributes", t, func() {
+
+		sv := SmartValues{}
+		st := SmartThresholds{}
+		for i, id := range []byte{1, 2, 3, 255} {
+			sv.Values[i].Id = id
+			sv.Values[i].Data = 20
+			st.Values[i].Id = id
+		}
+		st.Values[0].Threshold = 10
+		st.Values[1].Threshold = 20
+		st.Values[3].Threshold = 30
+
+		Convey("Should include unknown attributes", func() {
+
+			So(st.CountFailing(sv), ShouldEqual, 2)
+
+		})
+
 	})
 }
 
@@ -264,7 +722,7 @@ func TestAttributeFormat(t *testing.T) {
 
 			Convey("Keys and output of parsing is consistent", func() {
 
-				raw := [8]byte{}
+				raw := [6]byte{}
 				parsed := format.ParseRaw(raw)
 				Convey("Parsing returns every reported key", func() {
 					for _, key := range keys {